@@ -0,0 +1,112 @@
+// Package attachment encrypts files sent as attachments and transfers them through the HTTP API.
+//
+// Files are split into chunks of ChunkSize bytes, each sealed with a random key of its own that's sent
+// to the receiver inside the end-to-end encrypted message. The server only ever stores ciphertext.
+package attachment
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// ChunkSize is the size of the plaintext sealed into each chunk, the last chunk may be shorter.
+const ChunkSize = 256 << 10
+
+// sealedChunkSize is the size of a full chunk once sealed, uploads always resume at a multiple of it.
+const sealedChunkSize = ChunkSize + secretbox.Overhead
+
+var (
+	ErrInvalidKey = errors.New("invalid attachment key")
+	ErrCorrupted  = errors.New("attachment is corrupted")
+)
+
+// Key encrypts the chunks of a single attachment.
+type Key [32]byte
+
+func NewKey() (Key, error) {
+	var key Key
+
+	if _, err := rand.Read(key[:]); err != nil {
+		return Key{}, err
+	}
+
+	return key, nil
+}
+
+// ParseKey decodes a key encoded with Key.String.
+func ParseKey(s string) (Key, error) {
+	var key Key
+
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(decoded) != len(key) {
+		return Key{}, ErrInvalidKey
+	}
+
+	copy(key[:], decoded)
+
+	return key, nil
+}
+
+func (k Key) String() string {
+	return base64.StdEncoding.EncodeToString(k[:])
+}
+
+// SealChunk encrypts the chunk at the given index. Chunks are numbered from 0, the index is used as the
+// nonce, so chunks can't be reordered without being detected.
+func SealChunk(key Key, index int64, chunk []byte) []byte {
+	nonce := chunkNonce(index)
+	k := [32]byte(key)
+
+	return secretbox.Seal(nil, chunk, &nonce, &k)
+}
+
+// OpenChunk decrypts a chunk sealed with SealChunk.
+func OpenChunk(key Key, index int64, sealed []byte) ([]byte, error) {
+	nonce := chunkNonce(index)
+	k := [32]byte(key)
+
+	chunk, ok := secretbox.Open(nil, sealed, &nonce, &k)
+	if !ok {
+		return nil, ErrCorrupted
+	}
+
+	return chunk, nil
+}
+
+// SealedSize returns the size of a file of the given size once encrypted.
+func SealedSize(size int64) int64 {
+	chunks := (size + ChunkSize - 1) / ChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+
+	return size + chunks*secretbox.Overhead
+}
+
+func chunkNonce(index int64) [24]byte {
+	var nonce [24]byte
+	binary.LittleEndian.PutUint64(nonce[:], uint64(index))
+
+	return nonce
+}
+
+// FormatSize returns a human readable file size, e.g. "1.5 MB".
+func FormatSize(size int64) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,178 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Client uploads and downloads attachments. Uploads are resumable: the server keeps what it received
+// and reports its offset, so an interrupted upload continues from the last complete chunk.
+type Client struct {
+	// Endpoint returns the URL of an API path, e.g. config.Config.APIEndpoint.
+	Endpoint func(path string) string
+	// Token returns the JWT sent with every request.
+	Token func() (string, error)
+	HTTP  *http.Client
+}
+
+// Create registers a new upload of a file of the given size and returns its ID.
+func (c *Client) Create(size int64) (string, error) {
+	body, err := json.Marshal(map[string]int64{"size": SealedSize(size)})
+	if err != nil {
+		return "", err
+	}
+
+	res, err := c.do(http.MethodPost, "/v1/attachments", bytes.NewReader(body), nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		ID string `json:"id"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return "", err
+	}
+
+	return response.ID, nil
+}
+
+// Upload encrypts the file and uploads whatever the server hasn't received yet. progress, if set,
+// is called with the number of bytes of the file uploaded so far after every chunk.
+func (c *Client) Upload(id string, file io.ReaderAt, size int64, key Key, progress func(uploaded int64)) error {
+	offset, err := c.offset(id)
+	if err != nil {
+		return err
+	}
+
+	if offset%sealedChunkSize != 0 {
+		return fmt.Errorf("server reported offset %d, which isn't on a chunk boundary", offset)
+	}
+
+	sealedSize := SealedSize(size)
+	chunk := make([]byte, ChunkSize)
+
+	for index := offset / sealedChunkSize; offset < sealedSize; index++ {
+		n, err := file.ReadAt(chunk, index*ChunkSize)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		sealed := SealChunk(key, index, chunk[:n])
+
+		headers := map[string]string{"Upload-Offset": strconv.FormatInt(offset, 10)}
+
+		res, err := c.do(http.MethodPatch, "/v1/attachments/"+id, bytes.NewReader(sealed), headers)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+
+		offset += int64(len(sealed))
+
+		if progress != nil {
+			progress(min64(index*ChunkSize+int64(n), size))
+		}
+	}
+
+	return nil
+}
+
+// Download decrypts the attachment into w. size is the size of the file the sender announced,
+// a download of any other size is rejected as corrupted.
+func (c *Client) Download(id string, key Key, size int64, w io.Writer) error {
+	res, err := c.do(http.MethodGet, "/v1/attachments/"+id, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	sealed := make([]byte, sealedChunkSize)
+	written := int64(0)
+
+	for index := int64(0); ; index++ {
+		n, err := io.ReadFull(res.Body, sealed)
+		if err == io.EOF {
+			if index == 0 || written != size {
+				return ErrCorrupted
+			}
+
+			return nil
+		}
+
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		chunk, err := OpenChunk(key, index, sealed[:n])
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+
+		written += int64(len(chunk))
+	}
+}
+
+// offset returns how many bytes of the upload the server has received.
+func (c *Client) offset(id string) (int64, error) {
+	res, err := c.do(http.MethodHead, "/v1/attachments/"+id, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	return strconv.ParseInt(res.Header.Get("Upload-Offset"), 10, 64)
+}
+
+func (c *Client) do(method, path string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	token, err := c.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, c.Endpoint(path), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		res.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, path, res.Status)
+	}
+
+	return res, nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
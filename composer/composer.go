@@ -0,0 +1,486 @@
+package composer
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/tview"
+	"unicode"
+)
+
+// DefaultMaxLines is how many lines the composer grows to before it scrolls.
+const DefaultMaxLines = 6
+
+// Composer is a text input for messages that can span several lines. Enter finishes the message while
+// Alt+Enter, Shift+Enter and Ctrl+J start a new line. Long lines are wrapped at spaces.
+type Composer struct {
+	*tview.Box
+
+	text   []rune
+	cursor int
+
+	// rowOffset is the first row shown once there are more rows than fit.
+	rowOffset int
+
+	// width is what the text was wrapped to when the composer was last drawn.
+	width int
+
+	lines    int
+	maxLines int
+
+	placeholder      string
+	fieldStyle       tcell.Style
+	placeholderStyle tcell.Style
+
+	done         func(key tcell.Key)
+	changed      func(text string)
+	linesChanged func(lines int)
+}
+
+// row is a line as it's shown, the runes in [start, end) of the text.
+type row struct {
+	start, end int
+}
+
+// cell is a character as it's drawn, with the combining marks that follow it.
+type cell struct {
+	col       int
+	main      rune
+	combining []rune
+}
+
+func New() *Composer {
+	return &Composer{
+		Box:              tview.NewBox(),
+		lines:            1,
+		maxLines:         DefaultMaxLines,
+		fieldStyle:       tcell.StyleDefault.Background(tview.Styles.ContrastBackgroundColor).Foreground(tview.Styles.PrimaryTextColor),
+		placeholderStyle: tcell.StyleDefault.Background(tview.Styles.ContrastBackgroundColor).Foreground(tview.Styles.ContrastSecondaryTextColor),
+	}
+}
+
+func (c *Composer) SetText(text string) *Composer {
+	c.text = []rune(text)
+	c.cursor = len(c.text)
+	c.onChange()
+
+	return c
+}
+
+func (c *Composer) GetText() string {
+	return string(c.text)
+}
+
+func (c *Composer) SetPlaceholder(placeholder string) *Composer {
+	c.placeholder = placeholder
+	return c
+}
+
+// SetMaxLines sets how many lines the composer grows to, more lines can be scrolled through.
+func (c *Composer) SetMaxLines(lines int) *Composer {
+	c.maxLines = lines
+	return c
+}
+
+// SetDoneFunc sets the handler called when Enter, Escape, Tab or Shift+Tab is pressed.
+func (c *Composer) SetDoneFunc(handler func(key tcell.Key)) *Composer {
+	c.done = handler
+	return c
+}
+
+// SetChangedFunc sets the handler called whenever the text changes.
+func (c *Composer) SetChangedFunc(handler func(text string)) *Composer {
+	c.changed = handler
+	return c
+}
+
+// SetLinesChangedFunc sets the handler called when the composer needs a different number of lines to show
+// the text, so the layout can grow or shrink it.
+func (c *Composer) SetLinesChangedFunc(handler func(lines int)) *Composer {
+	c.linesChanged = handler
+	return c
+}
+
+// Lines returns the number of lines the composer needs, between 1 and its maximum.
+func (c *Composer) Lines() int {
+	return c.lines
+}
+
+func (c *Composer) Draw(screen tcell.Screen) {
+	c.Box.DrawForSubclass(screen, c)
+
+	x, y, width, height := c.GetInnerRect()
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	if width != c.width {
+		c.width = width
+		c.updateLines()
+	}
+
+	for row := 0; row < height; row++ {
+		for col := 0; col < width; col++ {
+			screen.SetContent(x+col, y+row, ' ', nil, c.fieldStyle)
+		}
+	}
+
+	if len(c.text) == 0 {
+		tview.Print(screen, tview.Escape(c.placeholder), x, y, width, tview.AlignLeft, tview.Styles.ContrastSecondaryTextColor)
+
+		if c.HasFocus() {
+			screen.ShowCursor(x, y)
+		}
+
+		return
+	}
+
+	rows := c.rows()
+	current := c.cursorRow(rows)
+
+	if current < c.rowOffset {
+		c.rowOffset = current
+	} else if current >= c.rowOffset+height {
+		c.rowOffset = current - height + 1
+	}
+
+	for i := c.rowOffset; i < len(rows) && i < c.rowOffset+height; i++ {
+		for _, cell := range c.cells(rows[i]) {
+			screen.SetContent(x+cell.col, y+i-c.rowOffset, cell.main, cell.combining, c.fieldStyle)
+		}
+	}
+
+	if c.HasFocus() {
+		screen.ShowCursor(x+c.column(rows[current], c.cursor), y+current-c.rowOffset)
+	}
+}
+
+func (c *Composer) InputHandler() func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
+	return c.WrapInputHandler(func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
+		switch key := event.Key(); key {
+		case tcell.KeyRune:
+			c.insert(event.Rune())
+		case tcell.KeyEnter:
+			if event.Modifiers()&(tcell.ModAlt|tcell.ModShift) != 0 {
+				c.insert('\n')
+			} else if c.done != nil {
+				c.done(key)
+			}
+		case tcell.KeyCtrlJ:
+			c.insert('\n')
+		case tcell.KeyEscape, tcell.KeyTab, tcell.KeyBacktab:
+			if c.done != nil {
+				c.done(key)
+			}
+		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			c.delete(c.cursor-1, c.cursor)
+		case tcell.KeyDelete, tcell.KeyCtrlD:
+			c.delete(c.cursor, c.cursor+1)
+		case tcell.KeyLeft:
+			c.moveTo(c.cursor - 1)
+		case tcell.KeyRight:
+			c.moveTo(c.cursor + 1)
+		case tcell.KeyUp:
+			c.moveRow(-1)
+		case tcell.KeyDown:
+			c.moveRow(1)
+		case tcell.KeyHome, tcell.KeyCtrlA:
+			c.moveTo(c.lineStart())
+		case tcell.KeyEnd, tcell.KeyCtrlE:
+			c.moveTo(c.lineEnd())
+		case tcell.KeyCtrlK:
+			// at the end of a line, the line break is deleted instead
+			if end := c.lineEnd(); end > c.cursor {
+				c.delete(c.cursor, end)
+			} else {
+				c.delete(c.cursor, c.cursor+1)
+			}
+		case tcell.KeyCtrlU:
+			c.delete(c.lineStart(), c.cursor)
+		case tcell.KeyCtrlW:
+			c.delete(c.wordStart(), c.cursor)
+		}
+	})
+}
+
+func (c *Composer) MouseHandler() func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+	return c.WrapMouseHandler(func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+		x, y := event.Position()
+		if !c.InRect(x, y) {
+			return false, nil
+		}
+
+		switch action {
+		case tview.MouseLeftClick:
+			setFocus(c)
+
+			innerX, innerY, _, _ := c.GetInnerRect()
+			rows := c.rows()
+
+			i := y - innerY + c.rowOffset
+			if i < 0 {
+				i = 0
+			} else if i >= len(rows) {
+				i = len(rows) - 1
+			}
+
+			c.cursor = c.positionAt(rows[i], x-innerX)
+		case tview.MouseScrollUp:
+			c.moveRow(-1)
+		case tview.MouseScrollDown:
+			c.moveRow(1)
+		default:
+			return false, nil
+		}
+
+		return true, nil
+	})
+}
+
+func (c *Composer) insert(r rune) {
+	c.text = append(c.text[:c.cursor], append([]rune{r}, c.text[c.cursor:]...)...)
+	c.cursor++
+	c.onChange()
+}
+
+// delete removes the runes in [from, to).
+func (c *Composer) delete(from, to int) {
+	if from < 0 {
+		from = 0
+	}
+
+	if to > len(c.text) {
+		to = len(c.text)
+	}
+
+	if from >= to {
+		return
+	}
+
+	c.text = append(c.text[:from], c.text[to:]...)
+	c.cursor = from
+	c.onChange()
+}
+
+func (c *Composer) onChange() {
+	c.updateLines()
+
+	if c.changed != nil {
+		c.changed(string(c.text))
+	}
+}
+
+func (c *Composer) updateLines() {
+	lines := len(c.rows())
+	if lines > c.maxLines {
+		lines = c.maxLines
+	}
+
+	if lines == c.lines {
+		return
+	}
+
+	c.lines = lines
+
+	if c.linesChanged != nil {
+		c.linesChanged(lines)
+	}
+}
+
+func (c *Composer) moveTo(position int) {
+	if position < 0 {
+		position = 0
+	} else if position > len(c.text) {
+		position = len(c.text)
+	}
+
+	c.cursor = position
+}
+
+// moveRow moves the cursor offset rows up or down, keeping it in the same column if that row is long enough.
+func (c *Composer) moveRow(offset int) {
+	rows := c.rows()
+	current := c.cursorRow(rows)
+
+	target := current + offset
+	if target < 0 || target >= len(rows) {
+		return
+	}
+
+	c.cursor = c.positionAt(rows[target], c.column(rows[current], c.cursor))
+}
+
+func (c *Composer) lineStart() int {
+	i := c.cursor
+	for i > 0 && c.text[i-1] != '\n' {
+		i--
+	}
+
+	return i
+}
+
+func (c *Composer) lineEnd() int {
+	i := c.cursor
+	for i < len(c.text) && c.text[i] != '\n' {
+		i++
+	}
+
+	return i
+}
+
+// wordStart returns where the word before the cursor starts, spaces between it and the cursor included.
+func (c *Composer) wordStart() int {
+	i := c.cursor
+	for i > 0 && unicode.IsSpace(c.text[i-1]) {
+		i--
+	}
+
+	for i > 0 && !unicode.IsSpace(c.text[i-1]) {
+		i--
+	}
+
+	return i
+}
+
+// rows wraps the text to the width of the composer. One column is kept free for the cursor after the
+// last character of a row.
+func (c *Composer) rows() []row {
+	width := c.width - 1
+	if width < 1 {
+		width = 1
+	}
+
+	var rows []row
+
+	for start := 0; start <= len(c.text); {
+		end := start
+		for end < len(c.text) && c.text[end] != '\n' {
+			end++
+		}
+
+		rows = append(rows, c.wrap(start, end, width)...)
+		start = end + 1
+	}
+
+	return rows
+}
+
+// wrap splits the line in [start, end) into rows no wider than width, breaking after spaces where possible.
+func (c *Composer) wrap(start, end, width int) []row {
+	if start == end {
+		return []row{{start, end}}
+	}
+
+	var rows []row
+
+	for start < end {
+		i, w, lastSpace := start, 0, -1
+		for ; i < end; i++ {
+			rw := runeWidth(c.text[i])
+			if w+rw > width && i > start {
+				break
+			}
+
+			w += rw
+			if c.text[i] == ' ' {
+				lastSpace = i
+			}
+		}
+
+		if i < end && lastSpace != -1 {
+			i = lastSpace + 1
+		}
+
+		rows = append(rows, row{start, i})
+		start = i
+	}
+
+	return rows
+}
+
+// cursorRow returns the index of the row the cursor is in. A cursor at the end of a wrapped row is shown
+// at the beginning of the next one.
+func (c *Composer) cursorRow(rows []row) int {
+	for i, r := range rows {
+		if c.cursor < r.start {
+			continue
+		}
+
+		wrapped := i+1 < len(rows) && rows[i+1].start == r.end
+		if c.cursor < r.end || c.cursor == r.end && !wrapped {
+			return i
+		}
+	}
+
+	return len(rows) - 1
+}
+
+// cells returns the characters of r the way they're drawn. Combining marks are drawn together with the
+// character before them, other characters without a width such as control characters aren't drawn.
+func (c *Composer) cells(r row) []cell {
+	var cells []cell
+	col := 0
+
+	for _, ch := range c.text[r.start:r.end] {
+		if ch == '\t' {
+			ch = ' '
+		}
+
+		w := runeWidth(ch)
+		if w == 0 {
+			if unicode.Is(unicode.M, ch) && len(cells) > 0 {
+				last := &cells[len(cells)-1]
+				last.combining = append(last.combining, ch)
+			}
+
+			continue
+		}
+
+		cells = append(cells, cell{col: col, main: ch})
+		col += w
+	}
+
+	return cells
+}
+
+// column returns the screen column of position within r.
+func (c *Composer) column(r row, position int) int {
+	col := 0
+	for _, ch := range c.text[r.start:position] {
+		col += runeWidth(ch)
+	}
+
+	return col
+}
+
+// positionAt returns the position in r shown at the screen column col, or the end of r if it's shorter.
+func (c *Composer) positionAt(r row, col int) int {
+	end := r.end
+
+	// the end of a wrapped row is shown at the beginning of the next one, see cursorRow
+	if end > r.start && end < len(c.text) && c.text[end] != '\n' {
+		end--
+
+		// combining marks stay with their character
+		for end > r.start && runeWidth(c.text[end]) == 0 {
+			end--
+		}
+	}
+
+	w := 0
+	for i := r.start; i < end; i++ {
+		w += runeWidth(c.text[i])
+		if w > col {
+			return i
+		}
+	}
+
+	return end
+}
+
+func runeWidth(r rune) int {
+	if r == '\t' {
+		return 1
+	}
+
+	return runewidth.RuneWidth(r)
+}
@@ -0,0 +1,169 @@
+package composer
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newComposer returns a composer holding text, wrapped as if it was drawn width columns wide. One column
+// is kept free for the cursor, so rows are at most width-1 columns wide.
+func newComposer(text string, width int) *Composer {
+	c := New()
+	c.width = width
+	c.SetText(text)
+
+	return c
+}
+
+func TestRows(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []row
+	}{
+		{"empty", "", []row{{0, 0}}},
+		{"short", "hello", []row{{0, 5}}},
+		{"exactly the width", "0123456789", []row{{0, 10}}},
+		{"wrapped after a space", "hello world foo", []row{{0, 6}, {6, 15}}},
+		{"wrapped after the last space", "a b c d e fghij", []row{{0, 10}, {10, 15}}},
+		{"wrapped mid-word", "abcdefghijklmno", []row{{0, 10}, {10, 15}}},
+		{"line break", "a\nb", []row{{0, 1}, {2, 3}}},
+		{"trailing line break", "a\n", []row{{0, 1}, {2, 2}}},
+		{"empty lines", "\n\n", []row{{0, 0}, {1, 1}, {2, 2}}},
+		{"wide characters", "日本語日本語", []row{{0, 5}, {5, 6}}},
+		{"wide character at the edge", "abcdefghi日", []row{{0, 9}, {9, 10}}},
+		{"combining marks", strings.Repeat("é", 12), []row{{0, 20}, {20, 24}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newComposer(tt.text, 11).rows(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCursorRow(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		cursor int
+		want   int
+	}{
+		{"start", "abcdefghijklmno", 0, 0},
+		{"before the wrap", "abcdefghijklmno", 9, 0},
+		{"at the wrap", "abcdefghijklmno", 10, 1},
+		{"end", "abcdefghijklmno", 15, 1},
+		{"end of a line", "ab\ncd", 2, 0},
+		{"start of the next line", "ab\ncd", 3, 1},
+		{"on an empty last line", "ab\n", 3, 1},
+		{"at a wrap after a space", "hello world foo", 6, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newComposer(tt.text, 11)
+			c.cursor = tt.cursor
+
+			if got := c.cursorRow(c.rows()); got != tt.want {
+				t.Errorf("got row %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPositionAt(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		row  int
+		col  int
+		want int
+	}{
+		{"first column", "hello", 0, 0, 0},
+		{"inside", "hello", 0, 3, 3},
+		{"past the end of the last row", "hello", 0, 8, 5},
+		{"past the end of a line", "ab\ncdef", 0, 5, 2},
+		{"past the end of a row wrapped after a space", "hello world foo", 0, 8, 5},
+		{"past the end of a row wrapped mid-word", "abcdefghijklmno", 0, 10, 9},
+		{"on a wide character", "日本語", 0, 3, 1},
+		{"past a combining mark", "éx", 0, 1, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newComposer(tt.text, 11)
+
+			if got := c.positionAt(c.rows()[tt.row], tt.col); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveRow(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		cursor int
+		offset int
+		want   int
+	}{
+		{"down a wrapped line", "abcdefghijklmno", 3, 1, 13},
+		{"up a wrapped line", "abcdefghijklmno", 14, -1, 4},
+		{"down to a shorter line", "abcdef\nab", 5, 1, 9},
+		{"up from the first row", "abc\ndef", 2, -1, 2},
+		{"down from the last row", "abc\ndef", 5, 1, 5},
+		{"onto a row wrapped after a space", "0123456789\nhello world foo", 10, 1, 16},
+		{"onto a row wrapped mid-word", "0123456789\nabcdefghijklmno", 10, 1, 20},
+		{"onto a wide character", "日本語\nabcdef", 9, -1, 2},
+		{"past wide characters", "日本語\nabcdef", 10, -1, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newComposer(tt.text, 11)
+			c.cursor = tt.cursor
+			row := c.cursorRow(c.rows()) + tt.offset
+
+			c.moveRow(tt.offset)
+
+			if c.cursor != tt.want {
+				t.Fatalf("got cursor %d, want %d", c.cursor, tt.want)
+			}
+
+			// the cursor is shown on the row it was moved to
+			if got := c.cursorRow(c.rows()); row >= 0 && row < len(c.rows()) && got != row {
+				t.Errorf("the cursor is shown on row %d, want %d", got, row)
+			}
+		})
+	}
+}
+
+func TestDrawCombiningMarks(t *testing.T) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+
+	screen.SetSize(20, 3)
+
+	c := New()
+	c.SetText("éx\x07y")
+	c.SetRect(0, 0, 20, 3)
+	c.Draw(screen)
+	screen.Show()
+
+	cells, _, _ := screen.GetContents()
+
+	want := [][]rune{{'e', '\u0301'}, {'x'}, {'y'}}
+	for i, runes := range want {
+		if !reflect.DeepEqual(cells[i].Runes, runes) {
+			t.Errorf("got %q in column %d, want %q", cells[i].Runes, i, runes)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/XiovV/selly-client/keymap"
+	"github.com/XiovV/selly-client/seed"
+	"github.com/XiovV/selly-client/theme"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	appName        = "selly"
+	configFileName = "config.json"
+)
+
+// Config holds the endpoints of the Selly instance the client talks to and the client's preferences.
+type Config struct {
+	APIURL       string `json:"api_url,omitempty"`
+	WebsocketURL string `json:"websocket_url,omitempty"`
+	HealthURL    string `json:"health_url,omitempty"`
+
+	// SeedWords is the number of words in newly generated seeds.
+	SeedWords int `json:"seed_words,omitempty"`
+
+	// LockAfter is how long the client may be idle before it locks itself, e.g. "10m".
+	// It only applies to profiles protected by a passphrase, "0" disables locking.
+	LockAfter string `json:"lock_after,omitempty"`
+
+	// AwayAfter is how long the client may be idle before friends see the user as away, "0" disables it.
+	AwayAfter string `json:"away_after,omitempty"`
+
+	// TimeFormat is the Go time layout used for message timestamps, e.g. "15:04" or "3:04PM".
+	TimeFormat string `json:"time_format,omitempty"`
+
+	// DownloadsDir is where received attachments are saved, it defaults to the user's downloads directory.
+	DownloadsDir string `json:"downloads_dir,omitempty"`
+
+	// Theme is the name of a built-in theme (dark, light, high-contrast or monochrome), the name of a
+	// theme file in the themes directory or the path to one.
+	Theme string `json:"theme,omitempty"`
+
+	// Keys overrides the keys bound to actions on the main screen, e.g. {"add_friend": "Ctrl+A"}.
+	Keys map[string]string `json:"keys,omitempty"`
+}
+
+func Default() *Config {
+	return &Config{
+		APIURL:       "http://localhost:8082",
+		WebsocketURL: "ws://localhost:8080/chat",
+		HealthURL:    "ws://localhost:8080/health",
+		SeedWords:    seed.DefaultLength,
+		LockAfter:    "10m",
+		AwayAfter:    "5m",
+		TimeFormat:   "15:04",
+	}
+}
+
+// DefaultPath returns the location of the config file inside the user's config directory,
+// e.g. $XDG_CONFIG_HOME/selly/config.json on Linux.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, appName, configFileName), nil
+}
+
+// ThemesDir returns the directory theme files are looked up in, e.g. $XDG_CONFIG_HOME/selly/themes on Linux.
+func ThemesDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, appName, "themes"), nil
+}
+
+// Loader resolves the Config of a profile. Values are applied in the following order, each step
+// overriding the previous one: built-in defaults, the global config file, the profile's config file,
+// environment variables, Server and finally Overrides, which usually come from command-line flags.
+type Loader struct {
+	Path      string
+	Server    string
+	Overrides Config
+}
+
+// Load builds the Config of the given profile. Missing config files are not an error.
+func (l *Loader) Load(profile Profile) (*Config, error) {
+	cfg := Default()
+
+	for _, path := range []string{l.Path, profile.configPath()} {
+		fileConfig, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Merge(fileConfig)
+	}
+
+	cfg.Merge(fromEnv())
+
+	if l.Server != "" {
+		if err := cfg.SetServer(l.Server); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.Merge(l.Overrides)
+
+	if !seed.ValidLength(cfg.SeedWords) {
+		return nil, fmt.Errorf("seed_words must be 12, 15, 18, 21 or 24, got: %d", cfg.SeedWords)
+	}
+
+	if _, err := time.ParseDuration(cfg.LockAfter); err != nil {
+		return nil, fmt.Errorf("lock_after: %w", err)
+	}
+
+	if _, err := time.ParseDuration(cfg.AwayAfter); err != nil {
+		return nil, fmt.Errorf("away_after: %w", err)
+	}
+
+	if _, err := keymap.New(cfg.Keys); err != nil {
+		return nil, fmt.Errorf("keys: %w", err)
+	}
+
+	if _, err := cfg.LoadTheme(); err != nil {
+		return nil, fmt.Errorf("theme: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Merge overrides every field of c with the matching field of other, unless it is empty.
+func (c *Config) Merge(other Config) {
+	if other.APIURL != "" {
+		c.APIURL = other.APIURL
+	}
+
+	if other.WebsocketURL != "" {
+		c.WebsocketURL = other.WebsocketURL
+	}
+
+	if other.HealthURL != "" {
+		c.HealthURL = other.HealthURL
+	}
+
+	if other.SeedWords != 0 {
+		c.SeedWords = other.SeedWords
+	}
+
+	if other.LockAfter != "" {
+		c.LockAfter = other.LockAfter
+	}
+
+	if other.AwayAfter != "" {
+		c.AwayAfter = other.AwayAfter
+	}
+
+	if other.TimeFormat != "" {
+		c.TimeFormat = other.TimeFormat
+	}
+
+	if other.DownloadsDir != "" {
+		c.DownloadsDir = other.DownloadsDir
+	}
+
+	if other.Theme != "" {
+		c.Theme = other.Theme
+	}
+
+	// keys are merged one by one, so a profile can rebind a single action
+	for action, key := range other.Keys {
+		if c.Keys == nil {
+			c.Keys = map[string]string{}
+		}
+
+		c.Keys[action] = key
+	}
+}
+
+// LockAfterDuration returns LockAfter as a duration, 0 means the client never locks itself.
+func (c *Config) LockAfterDuration() time.Duration {
+	d, _ := time.ParseDuration(c.LockAfter)
+
+	return d
+}
+
+// AwayAfterDuration returns AwayAfter as a duration, 0 means the user is never shown as away.
+func (c *Config) AwayAfterDuration() time.Duration {
+	d, _ := time.ParseDuration(c.AwayAfter)
+
+	return d
+}
+
+// LoadTheme loads the configured theme. Colours are left out if NO_COLOR is set, see https://no-color.org.
+func (c *Config) LoadTheme() (*theme.Theme, error) {
+	if os.Getenv("NO_COLOR") != "" {
+		return theme.Load(theme.Monochrome, "")
+	}
+
+	dir, err := ThemesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return theme.Load(c.Theme, dir)
+}
+
+// APIEndpoint joins path onto the API base URL.
+func (c *Config) APIEndpoint(path string) string {
+	return strings.TrimSuffix(c.APIURL, "/") + path
+}
+
+func readFile(path string) (Config, error) {
+	var cfg Config
+
+	if path == "" {
+		return cfg, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func fromEnv() Config {
+	return Config{
+		APIURL:       os.Getenv("SELLY_API_URL"),
+		WebsocketURL: os.Getenv("SELLY_WEBSOCKET_URL"),
+		HealthURL:    os.Getenv("SELLY_HEALTH_URL"),
+	}
+}
+
+// SetServer points every endpoint at the given host, keeping their ports and paths.
+// A server given as https://host switches the endpoints to https and wss.
+func (c *Config) SetServer(server string) error {
+	if !strings.Contains(server, "://") {
+		server = "//" + server
+	}
+
+	u, err := url.Parse(server)
+	if err != nil {
+		return err
+	}
+
+	if u.Hostname() == "" {
+		return fmt.Errorf("invalid server: %s", server)
+	}
+
+	if u.Port() != "" {
+		return fmt.Errorf("server must not include a port, set the endpoints in the config file instead")
+	}
+
+	secure := u.Scheme == "https" || u.Scheme == "wss"
+
+	for _, endpoint := range []*string{&c.APIURL, &c.WebsocketURL, &c.HealthURL} {
+		e, err := url.Parse(*endpoint)
+		if err != nil {
+			return err
+		}
+
+		if port := e.Port(); port != "" {
+			e.Host = net.JoinHostPort(u.Hostname(), port)
+		} else {
+			e.Host = u.Hostname()
+		}
+
+		if secure {
+			switch e.Scheme {
+			case "http":
+				e.Scheme = "https"
+			case "ws":
+				e.Scheme = "wss"
+			}
+		}
+
+		*endpoint = e.String()
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	DefaultProfile   = "default"
+	databaseFileName = "selly.db"
+)
+
+// DataDir returns the directory Selly keeps its databases in, e.g. $XDG_DATA_HOME/selly on Linux.
+func DataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, appName), nil
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("LocalAppData"); dir != "" {
+			return filepath.Join(dir, appName), nil
+		}
+
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.Join(dir, appName), nil
+	case "darwin":
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.Join(dir, appName), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".local", "share", appName), nil
+}
+
+// ProfileDir returns the directory holding the data of the given profile.
+func ProfileDir(profile string) (string, error) {
+	if err := ValidateProfileName(profile); err != nil {
+		return "", err
+	}
+
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "profiles", profile), nil
+}
+
+// ValidateProfileName makes sure a profile name can safely be used as a directory name.
+func ValidateProfileName(profile string) error {
+	if profile == "" {
+		return fmt.Errorf("profile name must not be empty")
+	}
+
+	if len(profile) > 64 {
+		return fmt.Errorf("profile name must be at most 64 characters long")
+	}
+
+	for _, c := range profile {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return fmt.Errorf("profile name may only contain letters, numbers, dashes and underscores")
+		}
+	}
+
+	return nil
+}
+
+// DownloadsPath returns the directory received attachments are saved to: the configured one, with a leading ~
+// expanded to the home directory, or else $XDG_DOWNLOAD_DIR or ~/Downloads.
+func (c *Config) DownloadsPath() (string, error) {
+	dir := c.DownloadsDir
+	if dir == "" {
+		dir = os.Getenv("XDG_DOWNLOAD_DIR")
+	}
+
+	if dir == "" {
+		dir = filepath.Join("~", "Downloads")
+	}
+
+	if dir == "~" || strings.HasPrefix(dir, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+
+		dir = filepath.Join(home, dir[1:])
+	}
+
+	return dir, nil
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Profile is a named account with its own database and, optionally, its own server config.
+type Profile struct {
+	Name     string
+	Dir      string
+	Database string
+}
+
+// OpenProfile returns the profile with the given name, creating its directory if it doesn't exist yet.
+func OpenProfile(name string) (Profile, error) {
+	dir, err := ProfileDir(name)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return Profile{}, err
+	}
+
+	return Profile{Name: name, Dir: dir, Database: filepath.Join(dir, databaseFileName)}, nil
+}
+
+// DatabaseProfile returns an unnamed profile backed by the database at path, it has no config of its own.
+func DatabaseProfile(path string) Profile {
+	return Profile{Name: filepath.Base(path), Database: path}
+}
+
+// ListProfiles returns every profile in the data directory, sorted by name.
+func ListProfiles() ([]Profile, error) {
+	profiles := []Profile{}
+
+	dir, err := DataDir()
+	if err != nil {
+		return profiles, err
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Join(dir, "profiles"))
+	if errors.Is(err, os.ErrNotExist) {
+		return profiles, nil
+	}
+
+	if err != nil {
+		return profiles, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || ValidateProfileName(entry.Name()) != nil {
+			continue
+		}
+
+		profile, err := OpenProfile(entry.Name())
+		if err != nil {
+			return profiles, err
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+
+	return profiles, nil
+}
+
+// SaveConfig writes the profile's own config, which takes precedence over the global config file.
+func (p Profile) SaveConfig(cfg Config) error {
+	if p.Dir == "" {
+		return errors.New("profile has no directory to store its config in")
+	}
+
+	file, err := json.MarshalIndent(cfg, "", " ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(p.configPath(), file, 0600)
+}
+
+func (p Profile) configPath() string {
+	if p.Dir == "" {
+		return ""
+	}
+
+	return filepath.Join(p.Dir, configFileName)
+}
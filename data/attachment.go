@@ -0,0 +1,143 @@
+package data
+
+import "github.com/jmoiron/sqlx"
+
+// Attachment is a file sent along with a message. Name and Key are encrypted at rest like messages.
+type Attachment struct {
+	ID        int64  `db:"id"`
+	MessageID string `db:"message_id"`
+	UploadID  string `db:"upload_id"`
+	Name      string `db:"name"`
+	Size      int64  `db:"size"`
+	Key       string `db:"key"`
+	Path      string `db:"path"`
+	Outgoing  bool   `db:"outgoing"`
+	Uploaded  bool   `db:"uploaded"`
+}
+
+const attachmentColumns = "id, message_id, upload_id, name, size, key, path, outgoing, uploaded"
+
+// StoreAttachment stores the attachment and returns its ID.
+func (r *Repository) StoreAttachment(attachment Attachment) (int64, error) {
+	name, err := r.encrypt(attachment.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := r.encrypt(attachment.Key)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := r.db.Exec("INSERT INTO attachments (message_id, upload_id, name, size, key, path, outgoing, uploaded) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		attachment.MessageID, attachment.UploadID, name, attachment.Size, key, attachment.Path, attachment.Outgoing, attachment.Uploaded)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (r *Repository) GetAttachment(id int64) (Attachment, error) {
+	var attachment Attachment
+
+	if err := r.db.Get(&attachment, "SELECT "+attachmentColumns+" FROM attachments WHERE id = ?", id); err != nil {
+		return Attachment{}, err
+	}
+
+	return attachment, r.decryptAttachment(&attachment)
+}
+
+func (r *Repository) GetAttachmentByMessageID(messageId string) (Attachment, error) {
+	var attachment Attachment
+
+	if err := r.db.Get(&attachment, "SELECT "+attachmentColumns+" FROM attachments WHERE message_id = ?", messageId); err != nil {
+		return Attachment{}, err
+	}
+
+	return attachment, r.decryptAttachment(&attachment)
+}
+
+// GetAttachments returns the attachments with the given IDs by their ID.
+func (r *Repository) GetAttachments(ids []int64) (map[int64]Attachment, error) {
+	attachments := map[int64]Attachment{}
+
+	if len(ids) == 0 {
+		return attachments, nil
+	}
+
+	query, args, err := sqlx.In("SELECT "+attachmentColumns+" FROM attachments WHERE id IN (?)", ids)
+	if err != nil {
+		return attachments, err
+	}
+
+	var rows []Attachment
+	if err := r.db.Select(&rows, query, args...); err != nil {
+		return attachments, err
+	}
+
+	for _, attachment := range rows {
+		if err := r.decryptAttachment(&attachment); err != nil {
+			return attachments, err
+		}
+
+		attachments[attachment.ID] = attachment
+	}
+
+	return attachments, nil
+}
+
+// GetPendingUploads returns the outgoing attachments that haven't been uploaded completely and whose
+// messages are still waiting to be sent.
+func (r *Repository) GetPendingUploads() ([]Attachment, error) {
+	attachments := []Attachment{}
+
+	if err := r.db.Select(&attachments, "SELECT "+attachmentColumns+` FROM attachments
+		WHERE outgoing = 1 AND uploaded = 0 AND message_id IN (SELECT message_id FROM outbox) ORDER BY id`); err != nil {
+		return attachments, err
+	}
+
+	for i := range attachments {
+		if err := r.decryptAttachment(&attachments[i]); err != nil {
+			return attachments, err
+		}
+	}
+
+	return attachments, nil
+}
+
+func (r *Repository) SetUploadID(id int64, uploadId string) error {
+	_, err := r.db.Exec("UPDATE attachments SET upload_id = $1 WHERE id = $2", uploadId, id)
+
+	return err
+}
+
+func (r *Repository) MarkUploaded(id int64) error {
+	_, err := r.db.Exec("UPDATE attachments SET uploaded = 1 WHERE id = ?", id)
+
+	return err
+}
+
+// SetAttachmentPath records where a received attachment was saved.
+func (r *Repository) SetAttachmentPath(id int64, path string) error {
+	_, err := r.db.Exec("UPDATE attachments SET path = $1 WHERE id = $2", path, id)
+
+	return err
+}
+
+func (r *Repository) decryptAttachment(attachment *Attachment) error {
+	name, err := r.decrypt(attachment.Name)
+	if err != nil {
+		return err
+	}
+
+	key, err := r.decrypt(attachment.Key)
+	if err != nil {
+		return err
+	}
+
+	attachment.Name = name
+	attachment.Key = key
+
+	return nil
+}
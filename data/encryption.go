@@ -0,0 +1,291 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	saltSetting  = "passphrase_salt"
+	checkSetting = "passphrase_check"
+
+	// checkValue is encrypted with the passphrase's key so the passphrase can be verified on unlock.
+	checkValue = "selly"
+)
+
+var (
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	ErrLocked          = errors.New("the database is locked")
+)
+
+// HasPassphrase reports whether the sensitive columns of the database are encrypted with a passphrase.
+func (r *Repository) HasPassphrase() bool {
+	return r.hasPassphrase
+}
+
+// Unlock derives the key from passphrase, it has to be called before reading or writing
+// a database protected by a passphrase.
+func (r *Repository) Unlock(passphrase string) error {
+	salt, err := r.getSetting(saltSetting)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	check, err := r.getSetting(checkSetting)
+	if err != nil {
+		return err
+	}
+
+	if value, err := decrypt(aead, check); err != nil || value != checkValue {
+		return ErrWrongPassphrase
+	}
+
+	r.cipher = aead
+
+	return r.encryptPlaintextPrivateKey()
+}
+
+// Lock forgets the key derived from the passphrase, Unlock has to be called again before the
+// encrypted columns can be read or written.
+func (r *Repository) Lock() {
+	r.cipher = nil
+}
+
+// encryptPlaintextPrivateKey encrypts the private key of databases protected by a passphrase before the
+// private key was encrypted too. The passphrase has been verified already, so a key that can't be
+// decrypted was never encrypted.
+func (r *Repository) encryptPlaintextPrivateKey() error {
+	var privateKey string
+	if err := r.db.Get(&privateKey, "SELECT private_key FROM user_info LIMIT 1"); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		return err
+	}
+
+	if _, err := r.decrypt(privateKey); err == nil {
+		return nil
+	}
+
+	encrypted, err := r.encrypt(privateKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("UPDATE user_info SET private_key = $1", encrypted)
+
+	return err
+}
+
+// ChangePassphrase re-encrypts the seed, private key, JWT and every message with a key derived from newPassphrase.
+// An empty newPassphrase removes the encryption. currentPassphrase is ignored if no passphrase is set.
+func (r *Repository) ChangePassphrase(currentPassphrase, newPassphrase string) error {
+	if r.HasPassphrase() {
+		if err := r.Unlock(currentPassphrase); err != nil {
+			return err
+		}
+	}
+
+	var newAEAD cipher.AEAD
+	var salt string
+
+	if newPassphrase != "" {
+		randomSalt := make([]byte, 16)
+		if _, err := rand.Read(randomSalt); err != nil {
+			return err
+		}
+
+		salt = base64.StdEncoding.EncodeToString(randomSalt)
+
+		aead, err := newCipher(newPassphrase, salt)
+		if err != nil {
+			return err
+		}
+
+		newAEAD = aead
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := r.reencrypt(tx, "user_info", "seed", newAEAD); err != nil {
+		return err
+	}
+
+	if err := r.reencrypt(tx, "user_info", "jwt", newAEAD); err != nil {
+		return err
+	}
+
+	if err := r.reencrypt(tx, "user_info", "private_key", newAEAD); err != nil {
+		return err
+	}
+
+	if err := r.reencrypt(tx, "messages", "message", newAEAD); err != nil {
+		return err
+	}
+
+	if err := r.reencrypt(tx, "attachments", "name", newAEAD); err != nil {
+		return err
+	}
+
+	if err := r.reencrypt(tx, "attachments", "key", newAEAD); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM settings WHERE key IN ($1, $2)", saltSetting, checkSetting); err != nil {
+		return err
+	}
+
+	if newAEAD != nil {
+		check, err := encrypt(newAEAD, checkValue)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("INSERT INTO settings (key, value) VALUES ($1, $2), ($3, $4)", saltSetting, salt, checkSetting, check); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	r.cipher = newAEAD
+	r.hasPassphrase = newAEAD != nil
+
+	return r.syncSearchIndex()
+}
+
+func (r *Repository) reencrypt(tx *sqlx.Tx, table, column string, newAEAD cipher.AEAD) error {
+	var rows []struct {
+		ID    int    `db:"id"`
+		Value string `db:"value"`
+	}
+
+	if err := tx.Select(&rows, "SELECT id, "+column+" AS value FROM "+table); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		value, err := r.decrypt(row.Value)
+		if err != nil {
+			return err
+		}
+
+		if newAEAD != nil {
+			value, err = encrypt(newAEAD, value)
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("UPDATE "+table+" SET "+column+" = $1 WHERE id = $2", value, row.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encrypt encrypts a value before it's written to a sensitive column, it's a no-op without a passphrase.
+func (r *Repository) encrypt(value string) (string, error) {
+	if !r.HasPassphrase() {
+		return value, nil
+	}
+
+	if r.cipher == nil {
+		return "", ErrLocked
+	}
+
+	return encrypt(r.cipher, value)
+}
+
+// decrypt decrypts a value read from a sensitive column, it's a no-op without a passphrase.
+func (r *Repository) decrypt(value string) (string, error) {
+	if !r.HasPassphrase() {
+		return value, nil
+	}
+
+	if r.cipher == nil {
+		return "", ErrLocked
+	}
+
+	return decrypt(r.cipher, value)
+}
+
+func (r *Repository) getSetting(key string) (string, error) {
+	var value string
+
+	err := r.db.Get(&value, "SELECT value FROM settings WHERE key = ?", key)
+
+	return value, err
+}
+
+func newCipher(passphrase, salt string) (cipher.AEAD, error) {
+	decodedSalt, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), decodedSalt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func encrypt(aead cipher.AEAD, value string) (string, error) {
+	// empty values are left as they are, user_info.jwt is empty until the first login
+	if value == "" {
+		return "", nil
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decrypt(aead cipher.AEAD, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrWrongPassphrase
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrWrongPassphrase
+	}
+
+	return string(plaintext), nil
+}
@@ -3,7 +3,7 @@ package data
 import "time"
 
 func (r *Repository) AddFriend(sellyId, username string) error {
-	_, err := r.db.Exec("INSERT INTO friends (selly_id, username) VALUES (?, ?)", sellyId, username)
+	_, err := r.db.Exec("INSERT INTO friends (selly_id, username, last_interaction) VALUES (?, ?, ?)", sellyId, username, time.Now().Unix())
 
 	return err
 }
@@ -21,7 +21,7 @@ func (r *Repository) GetFriends() ([]Friend, error) {
 func (r *Repository) GetFriendsSorted() ([]Friend, error) {
 	friends := []Friend{}
 
-	if err := r.db.Unsafe().Select(&friends, "SELECT selly_id, username, last_interaction FROM friends ORDER BY last_interaction DESC"); err != nil {
+	if err := r.db.Unsafe().Select(&friends, "SELECT selly_id, username, last_interaction, public_key, presence, last_seen, pending_public_key FROM friends ORDER BY last_interaction DESC"); err != nil {
 		return friends, err
 	}
 
@@ -30,7 +30,7 @@ func (r *Repository) GetFriendsSorted() ([]Friend, error) {
 func (r *Repository) GetFriendDataByUsername(username string) (Friend, error) {
 	var friend Friend
 
-	if err := r.db.Get(&friend, "SELECT selly_id, username, last_interaction FROM friends WHERE username = ?", username); err != nil {
+	if err := r.db.Get(&friend, "SELECT selly_id, username, last_interaction, public_key, presence, last_seen, pending_public_key FROM friends WHERE username = ?", username); err != nil {
 		return Friend{}, err
 	}
 
@@ -40,7 +40,7 @@ func (r *Repository) GetFriendDataByUsername(username string) (Friend, error) {
 func (r *Repository) GetFriendDataBySellyID(sellyId string) (Friend, error) {
 	var friend Friend
 
-	if err := r.db.Get(&friend, "SELECT selly_id, username, last_interaction FROM friends WHERE selly_id = ?", sellyId); err != nil {
+	if err := r.db.Get(&friend, "SELECT selly_id, username, last_interaction, public_key, presence, last_seen, pending_public_key FROM friends WHERE selly_id = ?", sellyId); err != nil {
 		return Friend{}, err
 	}
 
@@ -54,8 +54,13 @@ func (r *Repository) UpdateLastInteraction(sellyId string) error {
 }
 
 func (r *Repository) EditFriend(sellyId, newSellyId, username string) error {
-	_, err := r.db.Exec("UPDATE friends SET selly_id = $1, username = $2 WHERE selly_id = $3", newSellyId, username, sellyId)
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
+	_, err = tx.Exec("UPDATE friends SET selly_id = $1, username = $2 WHERE selly_id = $3", newSellyId, username, sellyId)
 	if err != nil {
 		return err
 	}
@@ -63,12 +68,12 @@ func (r *Repository) EditFriend(sellyId, newSellyId, username string) error {
 	// if the user changes the sellyId, it needs to be updated in the messages table, the selly_id and sender fields need to be updated.
 	// ON DELETE CASCADE is set up, but for some reason the selly_id field still doesn't get updated, so we're updating it here manually.
 	if sellyId != newSellyId {
-		tx, err := r.db.Begin()
+		_, err = tx.Exec("UPDATE messages SET selly_id = $1 WHERE selly_id = $2", newSellyId, sellyId)
 		if err != nil {
 			return err
 		}
 
-		_, err = tx.Exec("UPDATE messages SET selly_id = $1", newSellyId)
+		_, err = tx.Exec("UPDATE outbox SET selly_id = $1 WHERE selly_id = $2", newSellyId, sellyId)
 		if err != nil {
 			return err
 		}
@@ -78,17 +83,57 @@ func (r *Repository) EditFriend(sellyId, newSellyId, username string) error {
 			return err
 		}
 
-		err = tx.Commit()
+		_, err = tx.Exec("UPDATE group_members SET selly_id = $1 WHERE selly_id = $2", newSellyId, sellyId)
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return tx.Commit()
+}
+
+// UpdateFriendPublicKey stores a friend's public key, replacing a new key that's waiting to be accepted.
+func (r *Repository) UpdateFriendPublicKey(sellyId, publicKey string) error {
+	_, err := r.db.Exec("UPDATE friends SET public_key = $1, pending_public_key = '' WHERE selly_id = $2", publicKey, sellyId)
+
+	return err
+}
+
+// SetPendingPublicKey stores a new public key sent by a friend, it's used once the user accepts it.
+func (r *Repository) SetPendingPublicKey(sellyId, publicKey string) error {
+	_, err := r.db.Exec("UPDATE friends SET pending_public_key = $1 WHERE selly_id = $2", publicKey, sellyId)
+
+	return err
+}
+
+// AcceptPendingPublicKey replaces a friend's public key with the new one they sent.
+func (r *Repository) AcceptPendingPublicKey(sellyId string) error {
+	_, err := r.db.Exec("UPDATE friends SET public_key = pending_public_key, pending_public_key = '' WHERE selly_id = $1 AND pending_public_key != ''", sellyId)
+
+	return err
+}
+
+// UpdateFriendPresence stores whether a friend is online, lastSeen is only updated if it's set.
+func (r *Repository) UpdateFriendPresence(sellyId, presence string, lastSeen int64) error {
+	_, err := r.db.Exec("UPDATE friends SET presence = $1, last_seen = MAX(last_seen, $2) WHERE selly_id = $3", presence, lastSeen, sellyId)
+
+	return err
+}
+
+// ResetPresence marks every friend as offline, e.g. after losing the connection to the server.
+func (r *Repository) ResetPresence() error {
+	_, err := r.db.Exec("UPDATE friends SET presence = 'offline'")
+
+	return err
 }
 
 func (r *Repository) DeleteFriendByUsername(username string) error {
-	_, err := r.db.Exec("DELETE FROM friends WHERE username = ?", username)
+	_, err := r.db.Exec("DELETE FROM outbox WHERE selly_id = (SELECT selly_id FROM friends WHERE username = ?)", username)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("DELETE FROM friends WHERE username = ?", username)
 
 	return err
 }
@@ -0,0 +1,152 @@
+package data
+
+import (
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Group is a conversation with several members. Its messages are stored like the messages of a friend,
+// with GroupID taking the place of the friend's SellyID.
+type Group struct {
+	GroupID         string `db:"group_id"`
+	Name            string `db:"name"`
+	LastInteraction int    `db:"last_interaction"`
+
+	// Creator is the SellyID of the member who created the group, only they can invite others.
+	Creator string `db:"creator"`
+}
+
+// GroupMember is a member of a group, the local user included. PublicKey is the key the member was invited
+// with, it's used for members who aren't friends of the local user.
+type GroupMember struct {
+	GroupID   string `db:"group_id"`
+	SellyID   string `db:"selly_id"`
+	PublicKey string `db:"public_key"`
+}
+
+// NewGroupID returns a random ID for a new group.
+func NewGroupID() string {
+	return randomID()
+}
+
+// IsGroupID reports whether id has the form of an ID returned by NewGroupID.
+func IsGroupID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+
+	_, err := hex.DecodeString(id)
+
+	return err == nil && strings.ToLower(id) == id
+}
+
+// SaveGroup creates the group or renames it if it already exists, and replaces its members. The creator
+// of an existing group isn't changed.
+func (r *Repository) SaveGroup(group Group, members []GroupMember) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO groups (group_id, name, last_interaction, creator) VALUES ($1, $2, $3, $4) ON CONFLICT (group_id) DO UPDATE SET name = $2", group.GroupID, group.Name, time.Now().Unix(), group.Creator)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM group_members WHERE group_id = ?", group.GroupID)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		_, err = tx.Exec("INSERT INTO group_members (group_id, selly_id, public_key) VALUES (?, ?, ?)", group.GroupID, member.SellyID, member.PublicKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) GetGroupsSorted() ([]Group, error) {
+	groups := []Group{}
+
+	if err := r.db.Select(&groups, "SELECT group_id, name, last_interaction, creator FROM groups ORDER BY last_interaction DESC"); err != nil {
+		return groups, err
+	}
+
+	return groups, nil
+}
+
+func (r *Repository) GetGroup(groupId string) (Group, error) {
+	var group Group
+
+	if err := r.db.Get(&group, "SELECT group_id, name, last_interaction, creator FROM groups WHERE group_id = ?", groupId); err != nil {
+		return Group{}, err
+	}
+
+	return group, nil
+}
+
+func (r *Repository) GetGroupMembers(groupId string) ([]GroupMember, error) {
+	members := []GroupMember{}
+
+	if err := r.db.Select(&members, "SELECT group_id, selly_id, public_key FROM group_members WHERE group_id = ?", groupId); err != nil {
+		return members, err
+	}
+
+	return members, nil
+}
+
+func (r *Repository) GetGroupMember(groupId, sellyId string) (GroupMember, error) {
+	var member GroupMember
+
+	if err := r.db.Get(&member, "SELECT group_id, selly_id, public_key FROM group_members WHERE group_id = ? AND selly_id = ?", groupId, sellyId); err != nil {
+		return GroupMember{}, err
+	}
+
+	return member, nil
+}
+
+func (r *Repository) IsGroupMember(groupId, sellyId string) bool {
+	_, err := r.GetGroupMember(groupId, sellyId)
+
+	return err == nil
+}
+
+func (r *Repository) RemoveGroupMember(groupId, sellyId string) error {
+	_, err := r.db.Exec("DELETE FROM group_members WHERE group_id = ? AND selly_id = ?", groupId, sellyId)
+
+	return err
+}
+
+func (r *Repository) UpdateGroupLastInteraction(groupId string) error {
+	_, err := r.db.Exec("UPDATE groups SET last_interaction = $1 WHERE group_id = $2", time.Now().Unix(), groupId)
+
+	return err
+}
+
+// DeleteGroup deletes the group along with its members, messages and any messages still waiting to be sent to it.
+func (r *Repository) DeleteGroup(groupId string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM outbox WHERE selly_id = ?",
+		"DELETE FROM attachments WHERE message_id IN (SELECT message_id FROM messages WHERE selly_id = ?)",
+		"DELETE FROM messages WHERE selly_id = ?",
+		"DELETE FROM group_members WHERE group_id = ?",
+		"DELETE FROM groups WHERE group_id = ?",
+	} {
+		if _, err := tx.Exec(query, groupId); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -1,15 +1,70 @@
 package data
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/jmoiron/sqlx"
+)
+
+// Status of an outgoing message, it only ever moves forward. Pending messages are waiting in the outbox,
+// failed messages were taken out of it because they can't be sent.
+const (
+	StatusFailed = iota - 2
+	StatusPending
+	StatusSent
+	StatusDelivered
+	StatusRead
+)
+
 type Message struct {
-	Sender     string `json:"sender"`
-	Receiver   string `json:"receiver"`
-	Message    string `json:"message"`
-	DateCrated int64  `json:"date_crated"`
-	Read       int    `json:"read"`
+	RowID      int64  `json:"-" db:"id"`
+	ID         string `json:"id" db:"message_id"`
+	Sender     string `json:"sender" db:"sender"`
+	Receiver   string `json:"receiver" db:"receiver"`
+	Message    string `json:"message" db:"message"`
+	DateCrated int64  `json:"date_crated" db:"date_created"`
+	Read       int    `json:"read" db:"read"`
+	Status     int    `json:"-" db:"status"`
+
+	// IsGroup is set for messages to a group, it's only stored in the outbox.
+	IsGroup bool `json:"-" db:"is_group"`
+
+	// The following fields are only set by GetMessagesBefore and GetMessagesFrom. SenderName is empty if
+	// the sender isn't a friend, AttachmentID is 0 if the message has no attachment.
+	SenderName   string      `json:"-" db:"sender_name"`
+	AttachmentID int64       `json:"-" db:"attachment_id"`
+	Attachment   *Attachment `json:"-" db:"-"`
+}
+
+const messageQuery = `SELECT messages.id, messages.message_id, sender, message, date_created, status,
+		COALESCE(friends.username, '') AS sender_name, COALESCE(attachments.id, 0) AS attachment_id
+	FROM messages
+	LEFT JOIN friends ON friends.selly_id = messages.sender
+	LEFT JOIN attachments ON attachments.message_id = messages.message_id AND messages.message_id != ''`
+
+// NewMessageID returns a random ID, it's generated by the sender and used to acknowledge the message.
+func NewMessageID() string {
+	return randomID()
+}
+
+func randomID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
 }
 
 func (r *Repository) StoreMessage(sellyId string, message Message) error {
-	_, err := r.db.Exec("INSERT INTO messages (selly_id, sender, message, date_created, read) VALUES (?, ?, ?, ?, ?)", sellyId, message.Sender, message.Message, message.DateCrated, message.Read)
+	return r.storeMessage(r.db, sellyId, message)
+}
+
+func (r *Repository) storeMessage(db sqlx.Execer, sellyId string, message Message) error {
+	text, err := r.encrypt(message.Message)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("INSERT INTO messages (selly_id, message_id, sender, message, date_created, read, status) VALUES (?, ?, ?, ?, ?, ?, ?)", sellyId, message.ID, message.Sender, text, message.DateCrated, message.Read, message.Status)
 	if err != nil {
 		return err
 	}
@@ -17,6 +72,17 @@ func (r *Repository) StoreMessage(sellyId string, message Message) error {
 	return nil
 }
 
+// HasMessage reports whether the message messageId from sender is stored in the conversation sellyId already,
+// e.g. because it was received both live and as a missed message. IDs are chosen by the sender, so they're
+// only compared within the sender's messages to the conversation.
+func (r *Repository) HasMessage(sellyId, sender, messageId string) bool {
+	var count int
+
+	r.db.QueryRowx("SELECT COUNT(*) FROM messages WHERE selly_id = ? AND sender = ? AND message_id = ?", sellyId, sender, messageId).Scan(&count)
+
+	return count > 0
+}
+
 func (r *Repository) GetCountOfUnreadMessages(sellyId string) int {
 	var unread int
 
@@ -25,16 +91,104 @@ func (r *Repository) GetCountOfUnreadMessages(sellyId string) int {
 	return unread
 }
 
-func (r *Repository) GetMessages(sellyId string) ([]Message, error) {
+// GetMessagesBefore returns a page of up to limit messages from the conversation sellyId which are older
+// than the message with the RowID before, or the latest page if before is 0. Messages are sorted from
+// oldest to newest.
+func (r *Repository) GetMessagesBefore(sellyId string, before int64, limit int) ([]Message, error) {
 	messages := []Message{}
 
-	if err := r.db.Select(&messages, "SELECT sender, message FROM messages WHERE selly_id = ?", sellyId); err != nil {
+	if err := r.db.Select(&messages, messageQuery+` WHERE messages.selly_id = ? AND (? = 0 OR messages.id < ?)
+		ORDER BY messages.id DESC LIMIT ?`, sellyId, before, before, limit); err != nil {
 		return messages, err
 	}
 
-	return messages, nil
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messages, r.prepareMessages(messages)
+}
+
+// GetMessagesFrom returns the messages from the conversation sellyId starting with the one with the
+// RowID from, sorted from oldest to newest.
+func (r *Repository) GetMessagesFrom(sellyId string, from int64) ([]Message, error) {
+	messages := []Message{}
+
+	if err := r.db.Select(&messages, messageQuery+" WHERE messages.selly_id = ? AND messages.id >= ? ORDER BY messages.id", sellyId, from); err != nil {
+		return messages, err
+	}
+
+	return messages, r.prepareMessages(messages)
+}
+
+// prepareMessages decrypts the messages and fetches their attachments.
+func (r *Repository) prepareMessages(messages []Message) error {
+	var attachmentIds []int64
+
+	for i := range messages {
+		text, err := r.decrypt(messages[i].Message)
+		if err != nil {
+			return err
+		}
+
+		messages[i].Message = text
+
+		if messages[i].AttachmentID != 0 {
+			attachmentIds = append(attachmentIds, messages[i].AttachmentID)
+		}
+	}
+
+	attachments, err := r.GetAttachments(attachmentIds)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		if attachment, ok := attachments[messages[i].AttachmentID]; ok {
+			messages[i].Attachment = &attachment
+		}
+	}
+
+	return nil
+}
+
+// GetLastMessageRowID returns the RowID of the newest message in the conversation sellyId, 0 if it has none.
+func (r *Repository) GetLastMessageRowID(sellyId string) int64 {
+	var id int64
+
+	r.db.QueryRowx("SELECT COALESCE(MAX(id), 0) FROM messages WHERE selly_id = ?", sellyId).Scan(&id)
+
+	return id
 }
 
 func (r *Repository) SetRead(sellyId string) {
 	r.db.Exec("UPDATE messages SET read = 1 WHERE selly_id = $1 AND read = 0", sellyId)
 }
+
+// GetUnreadMessageIDs returns the IDs of the messages from sellyId that haven't been read yet.
+func (r *Repository) GetUnreadMessageIDs(sellyId string) ([]string, error) {
+	ids := []string{}
+
+	if err := r.db.Select(&ids, "SELECT message_id FROM messages WHERE selly_id = ? AND sender = ? AND read = 0 AND message_id != ''", sellyId, sellyId); err != nil {
+		return ids, err
+	}
+
+	return ids, nil
+}
+
+// UpdateMessageStatus moves the given messages sent to sellyId forward to status, messages which are
+// already further along are left alone.
+func (r *Repository) UpdateMessageStatus(sellyId string, ids []string, status int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlx.In("UPDATE messages SET status = ? WHERE selly_id = ? AND sender != ? AND status < ? AND message_id IN (?)", status, sellyId, sellyId, status, ids)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(query, args...)
+
+	return err
+}
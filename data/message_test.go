@@ -0,0 +1,45 @@
+package data
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+
+	r := NewRepository(filepath.Join(t.TempDir(), "selly.db"))
+	t.Cleanup(func() { r.Close() })
+
+	return r
+}
+
+func TestHasMessage(t *testing.T) {
+	r := newTestRepository(t)
+
+	if err := r.StoreMessage("alice", Message{ID: "message-id", Sender: "alice", Message: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		conversation string
+		sender       string
+		id           string
+		want         bool
+	}{
+		{"same message", "alice", "alice", "message-id", true},
+		{"other ID", "alice", "alice", "other-id", false},
+		{"same ID from someone else", "mallory", "mallory", "message-id", false},
+		{"same ID in a group", "group-id", "alice", "message-id", false},
+		{"same ID from someone else in the conversation", "alice", "mallory", "message-id", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.HasMessage(tt.conversation, tt.sender, tt.id); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
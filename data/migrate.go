@@ -0,0 +1,103 @@
+package data
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+)
+
+type column struct {
+	table, name, definition string
+}
+
+// migrate applies every migration the database hasn't seen yet, each one in its own transaction.
+func migrate(db *sqlx.DB) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("the database is at version %d, but this client only knows up to version %d, please update it", version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		if err := applyMigration(db, version); err != nil {
+			return fmt.Errorf("migration to version %d failed: %w", version+1, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(db *sqlx.DB, version int) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := migrations[version](tx); err != nil {
+		return err
+	}
+
+	// user_version is part of the database header, so it's only updated if the transaction commits
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func schemaVersion(db *sqlx.DB) (int, error) {
+	var version int
+
+	err := db.Get(&version, "PRAGMA user_version")
+
+	return version, err
+}
+
+func execMigration(query string) func(tx *sqlx.Tx) error {
+	return func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(query)
+
+		return err
+	}
+}
+
+// migrationSteps combines several steps into a single migration.
+func migrationSteps(steps ...func(tx *sqlx.Tx) error) func(tx *sqlx.Tx) error {
+	return func(tx *sqlx.Tx) error {
+		for _, step := range steps {
+			if err := step(tx); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// addColumnsMigration adds columns to existing tables, skipping the ones that already exist.
+func addColumnsMigration(columns ...column) func(tx *sqlx.Tx) error {
+	return func(tx *sqlx.Tx) error {
+		for _, c := range columns {
+			var exists int
+
+			err := tx.Get(&exists, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.name)
+			if err != nil {
+				return err
+			}
+
+			if exists > 0 {
+				continue
+			}
+
+			_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.name, c.definition))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
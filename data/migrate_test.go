@@ -0,0 +1,198 @@
+package data
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// legacySchema is what clients created before the schema was versioned, its columns could be null.
+const legacySchema = `
+	CREATE TABLE friends (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		selly_id TEXT NOT NULL UNIQUE,
+		username TEXT NOT NULL UNIQUE,
+		last_interaction INTEGER
+	);
+
+	CREATE TABLE user_info (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		selly_id TEXT NOT NULL UNIQUE,
+		seed TEXT NOT NULL UNIQUE,
+		jwt TEXT DEFAULT "" UNIQUE
+	);
+
+	CREATE TABLE messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		selly_id TEXT NOT NULL,
+		sender TEXT NOT NULL,
+		message TEXT NOT NULL,
+		date_created INTEGER,
+		read INTEGER,
+		FOREIGN KEY("selly_id") REFERENCES "friends"("selly_id") ON UPDATE CASCADE
+	);
+
+	INSERT INTO friends (selly_id, username, last_interaction) VALUES ('friend-id', 'bob', NULL);
+	INSERT INTO user_info (selly_id, seed) VALUES ('local-id', 'seed');
+	INSERT INTO messages (selly_id, sender, message, date_created, read) VALUES ('friend-id', 'friend-id', 'hello', NULL, NULL);
+`
+
+// versionedRows are stored in a database created by a versioned client, using only the columns of version 1.
+const versionedRows = `
+	INSERT INTO friends (selly_id, username) VALUES ('friend-id', 'bob');
+	INSERT INTO user_info (selly_id, seed) VALUES ('local-id', 'seed');
+	INSERT INTO messages (selly_id, sender, message) VALUES ('friend-id', 'friend-id', 'hello');
+`
+
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	db, err := sqlx.Connect("sqlite3", filepath.Join(t.TempDir(), "selly.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// databaseAt returns a database at the given schema version holding a friend, the local user and a message.
+func databaseAt(t *testing.T, version int) *sqlx.DB {
+	t.Helper()
+
+	db := openTestDB(t)
+
+	if version == 0 {
+		if _, err := db.Exec(legacySchema); err != nil {
+			t.Fatal(err)
+		}
+
+		return db
+	}
+
+	for v := 0; v < version; v++ {
+		if err := applyMigration(db, v); err != nil {
+			t.Fatalf("migration to version %d failed: %s", v+1, err)
+		}
+	}
+
+	if _, err := db.Exec(versionedRows); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// columns returns the names of every table's columns.
+func columns(t *testing.T, db *sqlx.DB) map[string][]string {
+	t.Helper()
+
+	var tables []string
+	if err := db.Select(&tables, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name"); err != nil {
+		t.Fatal(err)
+	}
+
+	schema := map[string][]string{}
+
+	for _, table := range tables {
+		var names []string
+		if err := db.Select(&names, "SELECT name FROM pragma_table_info(?) ORDER BY name", table); err != nil {
+			t.Fatal(err)
+		}
+
+		schema[table] = names
+	}
+
+	return schema
+}
+
+func TestMigrate(t *testing.T) {
+	fresh := openTestDB(t)
+	if err := migrate(fresh); err != nil {
+		t.Fatal(err)
+	}
+
+	want := columns(t, fresh)
+
+	for version := 0; version < len(migrations); version++ {
+		t.Run(fmt.Sprintf("from version %d", version), func(t *testing.T) {
+			db := databaseAt(t, version)
+
+			if err := migrate(db); err != nil {
+				t.Fatal(err)
+			}
+
+			if v, err := schemaVersion(db); err != nil || v != len(migrations) {
+				t.Fatalf("got version %d (%v), want %d", v, err, len(migrations))
+			}
+
+			if got := columns(t, db); !reflect.DeepEqual(got, want) {
+				t.Errorf("got schema %v, want %v", got, want)
+			}
+
+			friends, err := (&Repository{db: db}).GetFriends()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(friends) != 1 || friends[0].SellyID != "friend-id" || friends[0].Username != "bob" || friends[0].LastInteraction != 0 {
+				t.Errorf("got friends %+v, want bob with friend-id", friends)
+			}
+
+			var message struct {
+				Message     string `db:"message"`
+				DateCreated int64  `db:"date_created"`
+				Read        int    `db:"read"`
+			}
+
+			if err := db.Get(&message, "SELECT message, date_created, read FROM messages WHERE selly_id = 'friend-id'"); err != nil {
+				t.Fatal(err)
+			}
+
+			if message.Message != "hello" || message.DateCreated != 0 {
+				t.Errorf("got message %+v, want hello", message)
+			}
+
+			// legacy messages had no read flag, they're treated as read rather than all showing up as new
+			if version == 0 && message.Read != 1 {
+				t.Errorf("got read %d for a legacy message, want 1", message.Read)
+			}
+
+			var seed string
+			if err := db.Get(&seed, "SELECT seed FROM user_info WHERE selly_id = 'local-id'"); err != nil || seed != "seed" {
+				t.Errorf("got seed %q (%v), want seed", seed, err)
+			}
+		})
+	}
+}
+
+func TestMigrateTwice(t *testing.T) {
+	db := databaseAt(t, 0)
+
+	for i := 0; i < 2; i++ {
+		if err := migrate(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var friends int
+	if err := db.Get(&friends, "SELECT COUNT(*) FROM friends"); err != nil || friends != 1 {
+		t.Errorf("got %d friends (%v), want 1", friends, err)
+	}
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	db := openTestDB(t)
+
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(migrations)+1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrate(db); err == nil {
+		t.Error("migrating a database from a newer client succeeded")
+	}
+}
@@ -0,0 +1,94 @@
+package data
+
+// QueueMessage stores an outgoing message as pending and adds it to the outbox, from which it's sent
+// once there's a connection. sellyId is the ID of a group if message.IsGroup is set.
+func (r *Repository) QueueMessage(sellyId string, message Message) error {
+	message.Status = StatusPending
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := r.storeMessage(tx, sellyId, message); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("INSERT INTO outbox (message_id, selly_id, is_group) VALUES (?, ?, ?)", message.ID, sellyId, message.IsGroup); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetOutbox returns the messages waiting to be sent in the order they were written, Receiver is set
+// to the friend or group each message is for.
+func (r *Repository) GetOutbox() ([]Message, error) {
+	messages := []Message{}
+
+	query := `SELECT outbox.selly_id AS receiver, outbox.is_group, messages.message_id, messages.sender, messages.message, messages.date_created, messages.status
+		FROM outbox JOIN messages ON messages.message_id = outbox.message_id ORDER BY outbox.id`
+
+	if err := r.db.Select(&messages, query); err != nil {
+		return messages, err
+	}
+
+	for i := range messages {
+		text, err := r.decrypt(messages[i].Message)
+		if err != nil {
+			return messages, err
+		}
+
+		messages[i].Message = text
+	}
+
+	return messages, nil
+}
+
+// MarkSent removes a message from the outbox once it has been handed to the server.
+func (r *Repository) MarkSent(messageId string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM outbox WHERE message_id = ?", messageId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE messages SET status = ? WHERE message_id = ? AND status < ?", StatusSent, messageId, StatusSent); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MarkFailed removes a message that can't be sent from the outbox, e.g. because its attachment is gone.
+func (r *Repository) MarkFailed(messageId string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM outbox WHERE message_id = ?", messageId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE messages SET status = ? WHERE message_id = ? AND status = ?", StatusFailed, messageId, StatusPending); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CountOutbox returns the number of messages waiting to be sent.
+func (r *Repository) CountOutbox() int {
+	var count int
+
+	r.db.QueryRowx("SELECT COUNT(*) FROM outbox").Scan(&count)
+
+	return count
+}
@@ -0,0 +1,62 @@
+package data
+
+import "testing"
+
+func TestOutboxIsGroup(t *testing.T) {
+	r := newTestRepository(t)
+
+	// a group with the ID of a friend must not turn messages to the friend into group messages
+	if err := r.SaveGroup(Group{GroupID: "alice", Name: "alice"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.QueueMessage("alice", Message{ID: "direct", Sender: "local"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.QueueMessage("group-id", Message{ID: "group", Sender: "local", IsGroup: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := r.GetOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != 2 || messages[0].IsGroup || !messages[1].IsGroup {
+		t.Errorf("got %+v, want a direct message followed by a group message", messages)
+	}
+}
+
+func TestMarkFailed(t *testing.T) {
+	r := newTestRepository(t)
+
+	if err := r.QueueMessage("alice", Message{ID: "message-id", Sender: "local", Message: "file.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.StoreAttachment(Attachment{MessageID: "message-id", Name: "file.txt", Key: "key", Path: "/gone/file.txt", Outgoing: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.MarkFailed("message-id"); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := r.CountOutbox(); count != 0 {
+		t.Errorf("got %d messages in the outbox, want 0", count)
+	}
+
+	if uploads, err := r.GetPendingUploads(); err != nil || len(uploads) != 0 {
+		t.Errorf("got pending uploads %+v (%v), want none", uploads, err)
+	}
+
+	messages, err := r.GetMessagesFrom("alice", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != 1 || messages[0].Status != StatusFailed {
+		t.Errorf("got %+v, want a failed message", messages)
+	}
+}
@@ -1,24 +1,144 @@
 package data
 
-const migrateSchema = `
-	CREATE TABLE IF NOT EXISTS friends (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		selly_id TEXT NOT NULL UNIQUE,
-		username TEXT NOT NULL UNIQUE
-	);
-
-	CREATE TABLE IF NOT EXISTS user_info (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		selly_id TEXT NOT NULL UNIQUE,
-		seed TEXT NOT NULL UNIQUE,
-		jwt TEXT DEFAULT "" UNIQUE
-	);
-
-	CREATE TABLE IF NOT EXISTS messages (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		selly_id TEXT NOT NULL,
-		sender TEXT NOT NULL,
-		message TEXT NOT NULL,
-		FOREIGN KEY("selly_id") REFERENCES "friends"("selly_id") ON UPDATE CASCADE
-	);
-`
+import "github.com/jmoiron/sqlx"
+
+// migrations upgrade the schema one version at a time, migrations[i] upgrades a database from version i to i+1.
+// The version is stored in PRAGMA user_version. Never edit a migration once it has been released, add a new one instead.
+//
+// Databases created before versioning was introduced report version 0 while already having some of the tables
+// and columns, which is why the early migrations only create what's missing.
+var migrations = []func(tx *sqlx.Tx) error{
+	// 1: initial schema
+	execMigration(`
+		CREATE TABLE IF NOT EXISTS friends (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			selly_id TEXT NOT NULL UNIQUE,
+			username TEXT NOT NULL UNIQUE
+		);
+
+		CREATE TABLE IF NOT EXISTS user_info (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			selly_id TEXT NOT NULL UNIQUE,
+			seed TEXT NOT NULL UNIQUE,
+			jwt TEXT DEFAULT "" UNIQUE
+		);
+
+		CREATE TABLE IF NOT EXISTS messages (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			selly_id TEXT NOT NULL,
+			sender TEXT NOT NULL,
+			message TEXT NOT NULL,
+			FOREIGN KEY("selly_id") REFERENCES "friends"("selly_id") ON UPDATE CASCADE
+		);
+	`),
+
+	// 2: columns used for sorting friends and counting unread messages, older databases may have
+	// created them as nullable
+	migrationSteps(
+		addColumnsMigration(
+			column{"friends", "last_interaction", "INTEGER NOT NULL DEFAULT 0"},
+			column{"messages", "date_created", "INTEGER NOT NULL DEFAULT 0"},
+			column{"messages", "read", "INTEGER NOT NULL DEFAULT 0"},
+		),
+		execMigration(`
+			UPDATE friends SET last_interaction = 0 WHERE last_interaction IS NULL;
+			UPDATE messages SET date_created = 0 WHERE date_created IS NULL;
+			UPDATE messages SET read = 1 WHERE read IS NULL;
+		`),
+	),
+
+	// 3: end-to-end encryption keys
+	addColumnsMigration(
+		column{"friends", "public_key", `TEXT NOT NULL DEFAULT ""`},
+		column{"user_info", "public_key", `TEXT NOT NULL DEFAULT ""`},
+		column{"user_info", "private_key", `TEXT NOT NULL DEFAULT ""`},
+	),
+
+	// 4: settings, used for the passphrase
+	execMigration(`
+		CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);
+	`),
+
+	// 5: delivery and read receipts
+	migrationSteps(
+		addColumnsMigration(
+			column{"messages", "message_id", `TEXT NOT NULL DEFAULT ""`},
+			column{"messages", "status", "INTEGER NOT NULL DEFAULT 0"},
+		),
+		execMigration(`CREATE INDEX IF NOT EXISTS messages_message_id ON messages (message_id);`),
+	),
+
+	// 6: messages waiting to be sent
+	execMigration(`
+		CREATE TABLE IF NOT EXISTS outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id TEXT NOT NULL UNIQUE,
+			selly_id TEXT NOT NULL
+		);
+	`),
+
+	// 7: presence of friends
+	addColumnsMigration(
+		column{"friends", "presence", `TEXT NOT NULL DEFAULT 'offline'`},
+		column{"friends", "last_seen", "INTEGER NOT NULL DEFAULT 0"},
+	),
+
+	// 8: group chats, messages sent to a group are stored with the group's ID in messages.selly_id
+	execMigration(`
+		CREATE TABLE IF NOT EXISTS groups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			group_id TEXT NOT NULL UNIQUE,
+			name TEXT NOT NULL,
+			last_interaction INTEGER NOT NULL DEFAULT 0
+		);
+
+		CREATE TABLE IF NOT EXISTS group_members (
+			group_id TEXT NOT NULL,
+			selly_id TEXT NOT NULL,
+			public_key TEXT NOT NULL DEFAULT "",
+			PRIMARY KEY (group_id, selly_id)
+		);
+	`),
+
+	// 9: attachments, path is the file being sent or where a received file was saved
+	execMigration(`
+		CREATE TABLE IF NOT EXISTS attachments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id TEXT NOT NULL UNIQUE,
+			upload_id TEXT NOT NULL DEFAULT "",
+			name TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			key TEXT NOT NULL,
+			path TEXT NOT NULL DEFAULT "",
+			outgoing INTEGER NOT NULL DEFAULT 0,
+			uploaded INTEGER NOT NULL DEFAULT 0
+		);
+	`),
+
+	// 10: conversations are read a page at a time
+	execMigration(`CREATE INDEX IF NOT EXISTS messages_selly_id ON messages (selly_id, id);`),
+
+	// 11: a friend's new public key waits here until the user accepts it
+	addColumnsMigration(
+		column{"friends", "pending_public_key", `TEXT NOT NULL DEFAULT ""`},
+	),
+
+	// 12: only the creator of a group may change its members, it's empty for groups created before
+	addColumnsMigration(
+		column{"groups", "creator", `TEXT NOT NULL DEFAULT ""`},
+	),
+
+	// 13: whether a message waiting to be sent is for a group, rather than telling by its receiver's ID
+	migrationSteps(
+		addColumnsMigration(
+			column{"outbox", "is_group", "INTEGER NOT NULL DEFAULT 0"},
+		),
+		execMigration(`
+			UPDATE outbox SET is_group = 1
+			WHERE selly_id IN (SELECT group_id FROM groups) AND selly_id NOT IN (SELECT selly_id FROM friends);
+		`),
+	),
+}
@@ -0,0 +1,219 @@
+package data
+
+import "strings"
+
+// The full-text index isn't created by a migration: it holds the words of every message in plain text,
+// so it only exists while the messages themselves aren't encrypted with a passphrase. It also needs
+// SQLite to be built with FTS5 (go build -tags sqlite_fts5), without it searches scan the messages instead.
+const (
+	createSearchIndex = `
+		CREATE VIRTUAL TABLE messages_fts USING fts5(message, content='messages', content_rowid='id');
+
+		CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages BEGIN
+			INSERT INTO messages_fts (rowid, message) VALUES (new.id, new.message);
+		END;
+
+		CREATE TRIGGER messages_fts_delete AFTER DELETE ON messages BEGIN
+			INSERT INTO messages_fts (messages_fts, rowid, message) VALUES ('delete', old.id, old.message);
+		END;
+
+		CREATE TRIGGER messages_fts_update AFTER UPDATE OF message ON messages BEGIN
+			INSERT INTO messages_fts (messages_fts, rowid, message) VALUES ('delete', old.id, old.message);
+			INSERT INTO messages_fts (rowid, message) VALUES (new.id, new.message);
+		END;
+
+		INSERT INTO messages_fts (messages_fts) VALUES ('rebuild');
+	`
+
+	dropSearchIndex = `
+		DROP TRIGGER IF EXISTS messages_fts_insert;
+		DROP TRIGGER IF EXISTS messages_fts_delete;
+		DROP TRIGGER IF EXISTS messages_fts_update;
+		DROP TABLE IF EXISTS messages_fts;
+	`
+
+	// dropSearchTriggers is all that's dropped of an index created by a build with FTS5 when FTS5 is missing,
+	// the triggers would make every write to messages fail. The virtual table can't be dropped without the
+	// module, it's left alone until a build with FTS5 drops or rebuilds it.
+	dropSearchTriggers = `
+		DROP TRIGGER IF EXISTS messages_fts_insert;
+		DROP TRIGGER IF EXISTS messages_fts_delete;
+		DROP TRIGGER IF EXISTS messages_fts_update;
+	`
+
+	// clearSearchIndexWithoutFTS5 deletes the words of the messages from the shadow tables, which are ordinary
+	// tables to a build without FTS5, so no plain text is left behind once a passphrase is set. The averages
+	// (id 1) and the structure record (id 10) are kept, FTS5 can't open the table to drop it without them.
+	clearSearchIndexWithoutFTS5 = `
+		DELETE FROM messages_fts_data WHERE id NOT IN (1, 10);
+		DELETE FROM messages_fts_idx;
+	`
+)
+
+type SearchResult struct {
+	// RowID identifies the message within its conversation, it matches Message.RowID.
+	RowID      int64  `db:"id"`
+	SellyID    string `db:"selly_id"`
+	Sender     string `db:"sender"`
+	Message    string `db:"message"`
+	DateCrated int64  `db:"date_created"`
+}
+
+// SearchTerms splits a search query into the lower-cased words every result has to contain.
+func SearchTerms(query string) []string {
+	return strings.Fields(strings.ToLower(query))
+}
+
+// syncSearchIndex creates the full-text index if SQLite supports FTS5 and the messages aren't encrypted,
+// and drops it otherwise.
+func (r *Repository) syncSearchIndex() error {
+	available, err := r.fts5Available()
+	if err != nil {
+		return err
+	}
+
+	if r.hasPassphrase || !available {
+		r.searchIndex = false
+
+		return r.dropSearchIndex(available)
+	}
+
+	// the index is rebuilt if its triggers are missing, it wouldn't have been kept up to date
+	var triggers int
+	if err := r.db.Get(&triggers, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'messages_fts_insert'"); err != nil {
+		return err
+	}
+
+	if triggers == 0 {
+		tx, err := r.db.Beginx()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(dropSearchIndex); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(createSearchIndex); err != nil {
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	r.searchIndex = true
+
+	return nil
+}
+
+// fts5Available reports whether SQLite was built with FTS5, i.e. with go build -tags sqlite_fts5.
+func (r *Repository) fts5Available() (bool, error) {
+	var available bool
+	err := r.db.Get(&available, "SELECT sqlite_compileoption_used('ENABLE_FTS5')")
+
+	return available, err
+}
+
+// dropSearchIndex drops the full-text index, or only its triggers if SQLite lacks FTS5, see dropSearchTriggers.
+func (r *Repository) dropSearchIndex(fts5 bool) error {
+	var tables int
+	if err := r.db.Get(&tables, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'messages_fts'"); err != nil {
+		return err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	switch {
+	case fts5:
+		_, err = tx.Exec(dropSearchIndex)
+	case tables > 0 && r.hasPassphrase:
+		_, err = tx.Exec(dropSearchTriggers + clearSearchIndexWithoutFTS5)
+	default:
+		_, err = tx.Exec(dropSearchTriggers)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SearchMessages returns up to limit messages containing every word of query, newest first. Only
+// the conversation sellyId is searched, or every conversation if it's empty.
+func (r *Repository) SearchMessages(query, sellyId string, limit int) ([]SearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	if r.searchIndex {
+		return r.searchIndexed(terms, sellyId, limit)
+	}
+
+	return r.searchScan(terms, sellyId, limit)
+}
+
+func (r *Repository) searchIndexed(terms []string, sellyId string, limit int) ([]SearchResult, error) {
+	results := []SearchResult{}
+
+	// every term is quoted so FTS5 doesn't interpret it, and matched as a prefix
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+
+	err := r.db.Select(&results, `SELECT messages.id, selly_id, sender, messages.message, date_created
+		FROM messages_fts JOIN messages ON messages.id = messages_fts.rowid
+		WHERE messages_fts MATCH ? AND (? = '' OR selly_id = ?)
+		ORDER BY date_created DESC, messages.id DESC LIMIT ?`, strings.Join(phrases, " "), sellyId, sellyId, limit)
+
+	return results, err
+}
+
+// searchScan decrypts every message and looks for the terms in it, it's used when there's no index.
+func (r *Repository) searchScan(terms []string, sellyId string, limit int) ([]SearchResult, error) {
+	results := []SearchResult{}
+
+	rows, err := r.db.Queryx(`SELECT id, selly_id, sender, message, date_created FROM messages
+		WHERE ? = '' OR selly_id = ? ORDER BY date_created DESC, id DESC`, sellyId, sellyId)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() && len(results) < limit {
+		var result SearchResult
+		if err := rows.StructScan(&result); err != nil {
+			return results, err
+		}
+
+		result.Message, err = r.decrypt(result.Message)
+		if err != nil {
+			return results, err
+		}
+
+		if containsAll(strings.ToLower(result.Message), terms) {
+			results = append(results, result)
+		}
+	}
+
+	return results, rows.Err()
+}
+
+func containsAll(text string, terms []string) bool {
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,189 @@
+package data
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// storeSearchMessages stores a few messages in two conversations.
+func storeSearchMessages(t *testing.T, r *Repository) {
+	t.Helper()
+
+	messages := []struct {
+		conversation, text string
+	}{
+		{"alice", "Hello there"},
+		{"alice", "see you tomorrow"},
+		{"bob", "hello from bob"},
+		{"bob", `quotes " and * stay literal`},
+	}
+
+	for i, m := range messages {
+		if err := r.StoreMessage(m.conversation, Message{Sender: m.conversation, Message: m.text, DateCrated: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func assertFound(t *testing.T, r *Repository, query, conversation string, want ...string) {
+	t.Helper()
+
+	results, err := r.SearchMessages(query, conversation, 100)
+	if err != nil {
+		t.Fatalf("searching %q: %s", query, err)
+	}
+
+	got := make([]string, len(results))
+	for i, result := range results {
+		got[i] = result.Message
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("searching %q got %q, want %q", query, got, want)
+	}
+
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("searching %q got %q, want %q", query, got, want)
+		}
+	}
+}
+
+func searchIndexExists(t *testing.T, r *Repository) bool {
+	t.Helper()
+
+	var tables int
+	if err := r.db.Get(&tables, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'messages_fts'"); err != nil {
+		t.Fatal(err)
+	}
+
+	return tables > 0
+}
+
+func skipWithoutFTS5(t *testing.T, r *Repository) {
+	t.Helper()
+
+	if available, err := r.fts5Available(); err != nil || !available {
+		t.Skip("SQLite is built without FTS5, run the tests with -tags sqlite_fts5")
+	}
+}
+
+func TestSearchMessages(t *testing.T) {
+	r := newTestRepository(t)
+	storeSearchMessages(t, r)
+
+	assertFound(t, r, "hello", "", "hello from bob", "Hello there")
+	assertFound(t, r, "HEL", "alice", "Hello there")
+	assertFound(t, r, "hello bob", "", "hello from bob")
+	assertFound(t, r, "goodbye", "")
+	assertFound(t, r, "  ", "")
+
+	// FTS5 syntax in a query is matched as text rather than failing the search
+	if _, err := r.SearchMessages(`" * OR NEAR(stay`, "", 100); err != nil {
+		t.Errorf("got %v searching FTS5 syntax", err)
+	}
+}
+
+func TestSearchIndexTriggers(t *testing.T) {
+	r := newTestRepository(t)
+	skipWithoutFTS5(t, r)
+	storeSearchMessages(t, r)
+
+	if !r.searchIndex {
+		t.Fatal("the search index isn't used")
+	}
+
+	if _, err := r.db.Exec("UPDATE messages SET message = 'Goodbye there' WHERE message = 'Hello there'"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFound(t, r, "hello", "", "hello from bob")
+	assertFound(t, r, "goodbye", "", "Goodbye there")
+
+	if _, err := r.db.Exec("DELETE FROM messages WHERE selly_id = 'bob'"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFound(t, r, "hello", "")
+	assertFound(t, r, "there", "", "Goodbye there")
+}
+
+func TestSearchWithPassphrase(t *testing.T) {
+	r := newTestRepository(t)
+	storeSearchMessages(t, r)
+
+	if err := r.ChangePassphrase("", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the index would hold the messages in plain text
+	if r.searchIndex || searchIndexExists(t, r) {
+		t.Error("the search index is kept with a passphrase")
+	}
+
+	// the messages are decrypted and scanned instead
+	assertFound(t, r, "hello", "", "hello from bob", "Hello there")
+
+	if err := r.StoreMessage("alice", Message{Sender: "alice", Message: "hello again", DateCrated: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFound(t, r, "hello", "alice", "hello again", "Hello there")
+
+	if err := r.ChangePassphrase("secret", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFound(t, r, "hello", "alice", "hello again", "Hello there")
+}
+
+// TestSearchIndexWithoutFTS5 opens a database indexed by a build with FTS5 the way a build without FTS5 does,
+// and then with FTS5 again.
+func TestSearchIndexWithoutFTS5(t *testing.T) {
+	for _, passphrase := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "selly.db")
+
+		r := NewRepository(path)
+		skipWithoutFTS5(t, r)
+		storeSearchMessages(t, r)
+
+		r.hasPassphrase = passphrase
+		if err := r.dropSearchIndex(false); err != nil {
+			t.Fatal(err)
+		}
+
+		r.hasPassphrase = false
+		r.searchIndex = false
+
+		if !searchIndexExists(t, r) {
+			t.Fatal("the virtual table was dropped without FTS5")
+		}
+
+		var words int
+		if err := r.db.Get(&words, "SELECT COUNT(*) FROM messages_fts_data WHERE id NOT IN (1, 10)"); err != nil {
+			t.Fatal(err)
+		}
+
+		if passphrase && words != 0 {
+			t.Errorf("%d rows of the index were left behind with a passphrase", words)
+		}
+
+		// without the triggers messages can be written, and they're found by scanning
+		if err := r.StoreMessage("alice", Message{Sender: "alice", Message: "hello again", DateCrated: 10}); err != nil {
+			t.Fatal(err)
+		}
+
+		assertFound(t, r, "hello", "alice", "hello again", "Hello there")
+		r.Close()
+
+		// a build with FTS5 rebuilds the index, as it wasn't kept up to date
+		r = NewRepository(path)
+
+		if !r.searchIndex {
+			t.Fatal("the search index isn't used after being rebuilt")
+		}
+
+		assertFound(t, r, "hello", "alice", "hello again", "Hello there")
+		r.Close()
+	}
+}
@@ -1,13 +1,17 @@
 package data
 
 import (
+	"crypto/cipher"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
 )
 
 type Repository struct {
-	db *sqlx.DB
+	db            *sqlx.DB
+	cipher        cipher.AEAD
+	hasPassphrase bool
+	searchIndex   bool
 }
 
 func NewRepository(fileName string) *Repository {
@@ -16,7 +20,22 @@ func NewRepository(fileName string) *Repository {
 		log.Fatal(err)
 	}
 
-	db.MustExec(migrateSchema)
+	if err := migrate(db); err != nil {
+		log.Fatalf("couldn't migrate database: %s", err)
+	}
+
+	r := &Repository{db: db}
+
+	_, err = r.getSetting(saltSetting)
+	r.hasPassphrase = err == nil
+
+	if err := r.syncSearchIndex(); err != nil {
+		log.Fatalf("couldn't set up the search index: %s", err)
+	}
+
+	return r
+}
 
-	return &Repository{db: db}
+func (r *Repository) Close() error {
+	return r.db.Close()
 }
@@ -21,6 +21,11 @@ type Friend struct {
 	Username        string `db:"username"`
 	LastInteraction int    `db:"last_interaction"`
 	PublicKey       string `db:"public_key"`
+	Presence        string `db:"presence"`
+	LastSeen        int64  `db:"last_seen"`
+
+	// PendingPublicKey is a new key the friend sent, messages to them are held until the user accepts it.
+	PendingPublicKey string `db:"pending_public_key"`
 }
 
 func (u *LocalUser) GetHashedSeed() string {
@@ -39,11 +44,28 @@ func (r *Repository) GetLocalUserInfo() (LocalUser, error) {
 		return LocalUser{}, err
 	}
 
+	if userInfo.Seed, err = r.decrypt(userInfo.Seed); err != nil {
+		return LocalUser{}, err
+	}
+
+	if userInfo.JWT, err = r.decrypt(userInfo.JWT); err != nil {
+		return LocalUser{}, err
+	}
+
+	if userInfo.PrivateKey, err = r.decrypt(userInfo.PrivateKey); err != nil {
+		return LocalUser{}, err
+	}
+
 	return userInfo, nil
 }
 
 func (r *Repository) StoreLocalUserInfo(id, seed string) error {
-	_, err := r.db.Exec("INSERT INTO user_info (selly_id, seed) VALUES ($1, $2)", id, seed)
+	seed, err := r.encrypt(seed)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("INSERT INTO user_info (selly_id, seed) VALUES ($1, $2)", id, seed)
 	if err != nil {
 		return err
 	}
@@ -52,7 +74,26 @@ func (r *Repository) StoreLocalUserInfo(id, seed string) error {
 }
 
 func (r *Repository) UpdateJWT(jwt string) error {
-	_, err := r.db.Exec("UPDATE user_info SET jwt = $1", jwt)
+	jwt, err := r.encrypt(jwt)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("UPDATE user_info SET jwt = $1", jwt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) UpdateKeys(publicKey, privateKey string) error {
+	privateKey, err := r.encrypt(privateKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("UPDATE user_info SET public_key = $1, private_key = $2", publicKey, privateKey)
 	if err != nil {
 		return err
 	}
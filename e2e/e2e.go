@@ -0,0 +1,100 @@
+package e2e
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"strings"
+)
+
+const (
+	keySize   = 32
+	nonceSize = 24
+)
+
+var (
+	ErrInvalidKey     = errors.New("invalid key")
+	ErrDecryptionFail = errors.New("message could not be decrypted")
+)
+
+// DeriveKeyPair derives a Curve25519 keypair from the seed, so restoring an account also restores its keys.
+// Keys are returned base64 encoded.
+func DeriveKeyPair(seed string) (string, string, error) {
+	privateKey := sha256.Sum256([]byte("selly-e2e:" + strings.ReplaceAll(seed, ", ", "")))
+
+	publicKey, err := curve25519.X25519(privateKey[:], curve25519.Basepoint)
+	if err != nil {
+		return "", "", err
+	}
+
+	return encodeKey(publicKey), encodeKey(privateKey[:]), nil
+}
+
+// Encrypt seals message so only the owner of peerPublicKey can read it, and they can verify it was sent by us.
+func Encrypt(message, peerPublicKey, privateKey string) (string, error) {
+	peerKey, err := decodeKey(peerPublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	ownKey, err := decodeKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	var nonce [nonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return "", err
+	}
+
+	sealed := box.Seal(nonce[:], []byte(message), &nonce, peerKey, ownKey)
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a message sealed by the owner of peerPublicKey.
+func Decrypt(ciphertext, peerPublicKey, privateKey string) (string, error) {
+	peerKey, err := decodeKey(peerPublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	ownKey, err := decodeKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(sealed) < nonceSize {
+		return "", ErrDecryptionFail
+	}
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], sealed[:nonceSize])
+
+	message, ok := box.Open(nil, sealed[nonceSize:], &nonce, peerKey, ownKey)
+	if !ok {
+		return "", ErrDecryptionFail
+	}
+
+	return string(message), nil
+}
+
+func encodeKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func decodeKey(key string) (*[keySize]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(decoded) != keySize {
+		return nil, ErrInvalidKey
+	}
+
+	var k [keySize]byte
+	copy(k[:], decoded)
+
+	return &k, nil
+}
@@ -2,20 +2,17 @@ package friendslist
 
 import (
 	"fmt"
+	"github.com/XiovV/selly-client/theme"
 	"github.com/rivo/tview"
-	"strings"
-)
-
-const (
-	unreadMessageColor = "[#fccb00]"
 )
 
 type List struct {
 	treeView *tview.TreeView
+	theme    *theme.Theme
 }
 
-func New() *List {
-	f := List{}
+func New(theme *theme.Theme) *List {
+	f := List{theme: theme}
 
 	f.treeView = tview.NewTreeView()
 
@@ -34,51 +31,128 @@ func (f *List) GetTreeView() *tview.TreeView {
 	return f.treeView
 }
 
+// GetUsername returns the username of the friend shown by node.
+func (f *List) GetUsername(node *tview.TreeNode) string {
+	return listText(node).username
+}
+
+// IsGroup reports whether node shows a group rather than a friend.
+func (f *List) IsGroup(node *tview.TreeNode) bool {
+	return listText(node).isGroup
+}
+
+// GetGroupID returns the ID of the group shown by node.
+func (f *List) GetGroupID(node *tview.TreeNode) string {
+	return listText(node).sellyId
+}
+
 func (f *List) RemoveFriend(username string) {
-	node := f.findFriendInTreeNode(username)
+	f.removeNode(f.findFriendInTreeNode(username))
+}
 
-	f.getRoot().RemoveChild(node)
+func (f *List) RemoveGroup(groupId string) {
+	f.removeNode(f.findGroupInTreeNode(groupId))
 }
 
 func (f *List) EditFriendText(oldUsername, newUsername, sellyId string) {
 	node := f.findFriendInTreeNode(oldUsername)
-	node.SetText(fmt.Sprintf("%s (%s)", newUsername, truncateId(sellyId)))
+	if node == nil {
+		return
+	}
+
+	text := listText(node)
+	text.username = newUsername
+	text.sellyId = sellyId
+
+	f.updateText(node)
 }
 
-func (f *List) SanitizeNode(node *tview.TreeNode) {
-	removedColor := strings.ReplaceAll(node.GetText(), unreadMessageColor, "")
+func (f *List) RenameGroup(groupId, name string) {
+	node := f.findGroupInTreeNode(groupId)
+	if node == nil {
+		return
+	}
 
-	parsed := parseText(removedColor)
-	parsed.SetUnreadMessagesCounter(0)
+	listText(node).username = name
 
-	node.SetText(parsed.String())
+	f.updateText(node)
 }
 
-func (f *List) IncrementUnreadMessages(username string) {
-	friend := f.findFriendInTreeNode(username)
+// SanitizeNode clears the unread messages counter of node.
+func (f *List) SanitizeNode(node *tview.TreeNode) {
+	listText(node).SetUnreadMessagesCounter(0)
 
-	friendText := friend.GetText()
+	f.updateText(node)
+}
 
-	parsedText := parseText(friendText)
-	parsedText.IncrementUnreadMessages()
+func (f *List) IncrementUnreadMessages(username string) {
+	f.incrementUnreadMessages(f.findFriendInTreeNode(username))
+}
 
-	friend.SetText(unreadMessageColor + parsedText.String())
-	f.moveNodeToTop(friend)
+func (f *List) IncrementGroupUnreadMessages(groupId string) {
+	f.incrementUnreadMessages(f.findGroupInTreeNode(groupId))
 }
 
 func (f *List) SetUnreadCounter(username string, counter int) {
-	if counter == 0 {
+	f.setUnreadCounter(f.findFriendInTreeNode(username), counter)
+}
+
+func (f *List) SetGroupUnreadCounter(groupId string, counter int) {
+	f.setUnreadCounter(f.findGroupInTreeNode(groupId), counter)
+}
+
+// SetPresence updates the marker showing whether the friend is online, away or offline.
+func (f *List) SetPresence(username, presence string) {
+	friend := f.findFriendInTreeNode(username)
+	if friend == nil {
 		return
 	}
 
+	listText(friend).SetPresence(presence)
+
+	f.updateText(friend)
+}
+
+// SetUnverified marks a friend whose new security key hasn't been accepted yet.
+func (f *List) SetUnverified(username string, unverified bool) {
 	friend := f.findFriendInTreeNode(username)
+	if friend == nil {
+		return
+	}
 
-	friendText := friend.GetText()
+	listText(friend).SetUnverified(unverified)
 
-	parsedText := parseText(friendText)
-	parsedText.SetUnreadMessagesCounter(counter)
+	f.updateText(friend)
+}
 
-	friend.SetText(unreadMessageColor + parsedText.String())
+// ResetPresence shows every friend as offline.
+func (f *List) ResetPresence() {
+	for _, friend := range f.getRoot().GetChildren() {
+		listText(friend).SetPresence(Offline)
+
+		f.updateText(friend)
+	}
+}
+
+func (f *List) incrementUnreadMessages(node *tview.TreeNode) {
+	if node == nil {
+		return
+	}
+
+	listText(node).IncrementUnreadMessages()
+
+	f.updateText(node)
+	f.moveNodeToTop(node)
+}
+
+func (f *List) setUnreadCounter(node *tview.TreeNode, counter int) {
+	if node == nil || counter == 0 {
+		return
+	}
+
+	listText(node).SetUnreadMessagesCounter(counter)
+
+	f.updateText(node)
 }
 
 func (f *List) moveNodeToTop(node *tview.TreeNode) {
@@ -96,9 +170,15 @@ func (f *List) moveNodeToTop(node *tview.TreeNode) {
 }
 
 func (f *List) MoveToTop(username string) {
-	node := f.findFriendInTreeNode(username)
+	if node := f.findFriendInTreeNode(username); node != nil {
+		f.moveNodeToTop(node)
+	}
+}
 
-	f.moveNodeToTop(node)
+func (f *List) MoveGroupToTop(groupId string) {
+	if node := f.findGroupInTreeNode(groupId); node != nil {
+		f.moveNodeToTop(node)
+	}
 }
 
 func (f *List) GetFirst() *tview.TreeNode {
@@ -111,17 +191,51 @@ func (f *List) GetFirst() *tview.TreeNode {
 	return nil
 }
 
+// Sibling returns the node offset places below node, or above it if offset is negative. It returns nil if
+// there's no such node, and the first node if node is nil.
+func (f *List) Sibling(node *tview.TreeNode, offset int) *tview.TreeNode {
+	children := f.getRoot().GetChildren()
+
+	if node == nil {
+		return f.GetFirst()
+	}
+
+	for i, child := range children {
+		if child == node && i+offset >= 0 && i+offset < len(children) {
+			return children[i+offset]
+		}
+	}
+
+	return nil
+}
+
 func (f *List) SetCurrentFriend(node *tview.TreeNode) {
 	f.treeView.SetCurrentNode(node)
 }
 
+// FindConversation returns the node of the friend with the SellyID id or of the group with the ID id.
+func (f *List) FindConversation(id string) *tview.TreeNode {
+	return f.findNode(func(text *ListText) bool {
+		return text.sellyId == id
+	})
+}
+
 func (f *List) findFriendInTreeNode(username string) *tview.TreeNode {
-	for _, friend := range f.treeView.GetRoot().GetChildren() {
-		friendSplit := strings.Split(friend.GetText(), " ")
-		friendUsername := strings.ReplaceAll(friendSplit[0], unreadMessageColor, "")
+	return f.findNode(func(text *ListText) bool {
+		return !text.isGroup && text.username == username
+	})
+}
 
-		if friendUsername == username {
-			return friend
+func (f *List) findGroupInTreeNode(groupId string) *tview.TreeNode {
+	return f.findNode(func(text *ListText) bool {
+		return text.isGroup && text.sellyId == groupId
+	})
+}
+
+func (f *List) findNode(match func(text *ListText) bool) *tview.TreeNode {
+	for _, node := range f.treeView.GetRoot().GetChildren() {
+		if match(listText(node)) {
+			return node
 		}
 	}
 
@@ -129,7 +243,17 @@ func (f *List) findFriendInTreeNode(username string) *tview.TreeNode {
 }
 
 func (f *List) AddFriend(username, sellyId string) {
-	node := tview.NewTreeNode(fmt.Sprintf("%s (%s)", username, truncateId(sellyId)))
+	f.addText(NewListText(username, sellyId, 0))
+}
+
+func (f *List) AddGroup(name, groupId string) {
+	f.addText(NewGroupListText(name, groupId, 0))
+}
+
+func (f *List) addText(text ListText) {
+	node := tview.NewTreeNode("").SetReference(&text)
+	f.updateText(node)
+
 	f.addChild(node)
 }
 
@@ -137,10 +261,25 @@ func (f *List) addChild(node *tview.TreeNode) {
 	f.getRoot().AddChild(node)
 }
 
+func (f *List) removeNode(node *tview.TreeNode) {
+	if node != nil {
+		f.getRoot().RemoveChild(node)
+	}
+}
+
 func (f *List) getRoot() *tview.TreeNode {
 	return f.treeView.GetRoot()
 }
 
+func listText(node *tview.TreeNode) *ListText {
+	return node.GetReference().(*ListText)
+}
+
+// updateText renders the node's ListText again after it changed.
+func (f *List) updateText(node *tview.TreeNode) {
+	node.SetText(listText(node).Render(f.theme))
+}
+
 func truncateId(id string) string {
 	return fmt.Sprintf("%s...%s", id[:7], id[len(id)-7:])
 }
@@ -2,14 +2,33 @@ package friendslist
 
 import (
 	"fmt"
-	"strconv"
-	"strings"
+	"github.com/XiovV/selly-client/theme"
+	"github.com/rivo/tview"
 )
 
+const (
+	Online  = "online"
+	Away    = "away"
+	Offline = "offline"
+)
+
+const (
+	presenceMarker   = "●"
+	groupMarker      = "#"
+	unverifiedMarker = "!"
+)
+
+// ListText holds everything shown about a friend or group in the list, it's stored as the reference of their node.
+// For groups, username holds the group's name and sellyId the group's ID.
 type ListText struct {
 	username       string
 	sellyId        string
 	unreadMessages int
+	presence       string
+	isGroup        bool
+
+	// unverified is set while a new security key of the friend waits to be accepted.
+	unverified bool
 }
 
 func NewListText(username, sellyId string, unreadMessages int) ListText {
@@ -17,36 +36,19 @@ func NewListText(username, sellyId string, unreadMessages int) ListText {
 		username:       username,
 		sellyId:        sellyId,
 		unreadMessages: unreadMessages,
+		presence:       Offline,
 	}
 }
 
-func parseText(text string) ListText {
-	textSplit := strings.Split(text, " ")
-
-	username := textSplit[0]
-	truncatedId := textSplit[1]
-	unreadMessages := parseUnreadMessages(text)
-
+func NewGroupListText(name, groupId string, unreadMessages int) ListText {
 	return ListText{
-		username:       username,
-		sellyId:        truncatedId,
+		username:       name,
+		sellyId:        groupId,
 		unreadMessages: unreadMessages,
+		isGroup:        true,
 	}
 }
 
-func parseUnreadMessages(text string) int {
-	textSplit := strings.Split(text, " ")
-
-	if len(textSplit) < 3 {
-		return 0
-	}
-
-	r := strings.NewReplacer("(", "", ")", "")
-
-	unreadMessages, _ := strconv.Atoi(r.Replace(textSplit[2]))
-	return unreadMessages
-}
-
 func (t *ListText) IncrementUnreadMessages() {
 	t.unreadMessages += 1
 }
@@ -55,13 +57,43 @@ func (t *ListText) SetUnreadMessagesCounter(n int) {
 	t.unreadMessages = n
 }
 
-func (t *ListText) String() string {
-	//TODO: consider refactoring this
+// SetPresence sets whether the friend is online, away or offline. Unknown values are shown as offline.
+func (t *ListText) SetPresence(presence string) {
+	switch presence {
+	case Online, Away:
+		t.presence = presence
+	default:
+		t.presence = Offline
+	}
+}
+
+// SetUnverified sets whether the friend sent a new security key that hasn't been accepted yet.
+func (t *ListText) SetUnverified(unverified bool) {
+	t.unverified = unverified
+}
+
+// Render returns the text shown in the list, coloured with th.
+func (t *ListText) Render(th *theme.Theme) string {
 	var s string
-	if strings.Contains(t.sellyId, "(") {
-		s = fmt.Sprintf("%s %s", t.username, t.sellyId)
+	if t.isGroup {
+		s = fmt.Sprintf("%s%s[-:-:-] ", th.Muted.Tag(), groupMarker)
 	} else {
-		s = fmt.Sprintf("%s (%s)", t.username, truncateId(t.sellyId))
+		s = fmt.Sprintf("%s%s[-:-:-] ", presenceStyle(th, t.presence).Tag(), presenceMarker)
+	}
+
+	if t.unverified {
+		s += fmt.Sprintf("%s%s[-:-:-] ", th.Error.Tag(), unverifiedMarker)
+	}
+
+	if t.unreadMessages > 0 {
+		s += th.Warning.Tag()
+	}
+
+	// names are chosen by other users, e.g. group names, and mustn't add colors to the list
+	if t.isGroup {
+		s += tview.Escape(t.username)
+	} else {
+		s += tview.Escape(fmt.Sprintf("%s (%s)", t.username, truncateId(t.sellyId)))
 	}
 
 	if t.unreadMessages > 0 {
@@ -70,3 +102,14 @@ func (t *ListText) String() string {
 
 	return s
 }
+
+func presenceStyle(th *theme.Theme, presence string) theme.Style {
+	switch presence {
+	case Online:
+		return th.Success
+	case Away:
+		return th.Warning
+	}
+
+	return th.Muted
+}
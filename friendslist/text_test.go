@@ -0,0 +1,37 @@
+package friendslist
+
+import (
+	"github.com/XiovV/selly-client/theme"
+	"github.com/rivo/tview"
+	"strings"
+	"testing"
+)
+
+func TestRenderHostile(t *testing.T) {
+	th, _ := theme.Load(theme.Dark, "")
+
+	names := []string{
+		"[red]red[-]",
+		"[:red]background",
+		"[::bl]blinking",
+		`["evil"]region[""]`,
+		"[red[]escaped",
+		"[[[",
+		"a[b]c[d",
+		strings.Repeat("[red]A", 2000),
+	}
+
+	for _, name := range names {
+		for _, text := range []ListText{NewListText(name, "0123456789abcdef", 3), NewGroupListText(name, "group-id", 3)} {
+			text.SetUnverified(true)
+
+			// the count of unread messages follows the name, so nothing of the name can be held back as a partial tag
+			view := tview.NewTextView().SetDynamicColors(true).SetRegions(true)
+			view.SetText(text.Render(th))
+
+			if shown := view.GetText(true); !strings.Contains(shown, name) {
+				t.Errorf("%q isn't shown as it is, got %q", name, shown)
+			}
+		}
+	}
+}
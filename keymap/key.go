@@ -0,0 +1,142 @@
+package keymap
+
+import (
+	"fmt"
+	"github.com/gdamore/tcell/v2"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Key is a key combined with modifiers, written like "Ctrl+N", "Alt+Up", "Shift+Tab" or "F1".
+type Key struct {
+	key  tcell.Key
+	ch   rune
+	mods tcell.ModMask
+}
+
+// Parse parses a key written like "Ctrl+N". Modifiers and the names of special keys are case-insensitive,
+// Ctrl can only be combined with letters.
+func Parse(s string) (Key, error) {
+	parts := strings.Split(s, "+")
+
+	// the plus key itself, e.g. "Alt++"
+	if strings.HasSuffix(s, "++") {
+		parts = append(parts[:len(parts)-2], "+")
+	}
+
+	var mods tcell.ModMask
+
+	for _, modifier := range parts[:len(parts)-1] {
+		switch strings.ToLower(modifier) {
+		case "ctrl":
+			mods |= tcell.ModCtrl
+		case "alt":
+			mods |= tcell.ModAlt
+		case "shift":
+			mods |= tcell.ModShift
+		default:
+			return Key{}, fmt.Errorf("unknown modifier %q in %q", modifier, s)
+		}
+	}
+
+	name := parts[len(parts)-1]
+
+	if strings.EqualFold(name, "space") {
+		name = " "
+	}
+
+	if utf8.RuneCountInString(name) == 1 {
+		ch, _ := utf8.DecodeRuneInString(name)
+
+		// terminals send Alt with the lower-case letter
+		if mods&tcell.ModAlt != 0 {
+			ch = unicode.ToLower(ch)
+		}
+
+		if mods&tcell.ModCtrl == 0 {
+			return Key{key: tcell.KeyRune, ch: ch, mods: mods &^ tcell.ModShift}, nil
+		}
+
+		ch = unicode.ToLower(ch)
+		if ch < 'a' || ch > 'z' {
+			return Key{}, fmt.Errorf("%q: Ctrl can only be combined with letters", s)
+		}
+
+		return Key{key: tcell.KeyCtrlA + tcell.Key(ch-'a'), mods: mods &^ tcell.ModShift}, nil
+	}
+
+	if strings.EqualFold(name, "tab") && mods&tcell.ModShift != 0 {
+		return Key{key: tcell.KeyBacktab, mods: mods &^ tcell.ModShift}, nil
+	}
+
+	for key, keyName := range tcell.KeyNames {
+		if strings.EqualFold(keyName, name) && !strings.HasPrefix(keyName, "Ctrl-") {
+			return Key{key: key, mods: mods}, nil
+		}
+	}
+
+	return Key{}, fmt.Errorf("unknown key %q", s)
+}
+
+// Matches reports whether the event is this key being pressed.
+func (k Key) Matches(event *tcell.EventKey) bool {
+	if event.Key() != k.key {
+		return false
+	}
+
+	// terminals don't report Shift reliably for characters and Shift+Tab, and control characters always
+	// carry Ctrl
+	mask := tcell.ModCtrl | tcell.ModAlt | tcell.ModShift
+	switch {
+	case k.key == tcell.KeyRune:
+		ch := event.Rune()
+		if event.Modifiers()&tcell.ModAlt != 0 {
+			ch = unicode.ToLower(ch)
+		}
+
+		if ch != k.ch {
+			return false
+		}
+
+		mask = tcell.ModCtrl | tcell.ModAlt
+	case k.key == tcell.KeyBacktab:
+		mask = tcell.ModCtrl | tcell.ModAlt
+	case k.key >= tcell.KeyCtrlA && k.key <= tcell.KeyCtrlZ:
+		mask = tcell.ModAlt
+	}
+
+	return event.Modifiers()&mask == k.mods&mask
+}
+
+func (k Key) String() string {
+	var parts []string
+
+	name := tcell.KeyNames[k.key]
+
+	switch {
+	case k.key == tcell.KeyRune && k.ch == ' ':
+		name = "Space"
+	case k.key == tcell.KeyRune:
+		name = string(k.ch)
+	case k.key == tcell.KeyBacktab:
+		name = "Shift+Tab"
+	case strings.HasPrefix(name, "Ctrl-"):
+		parts = append(parts, "Ctrl")
+		name = name[len("Ctrl-"):]
+	}
+
+	if k.mods&tcell.ModCtrl != 0 && len(parts) == 0 {
+		parts = append(parts, "Ctrl")
+	}
+
+	if k.mods&tcell.ModAlt != 0 {
+		parts = append(parts, "Alt")
+	}
+
+	if k.mods&tcell.ModShift != 0 {
+		parts = append(parts, "Shift")
+	}
+
+	return strings.Join(append(parts, name), "+")
+}
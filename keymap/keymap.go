@@ -0,0 +1,148 @@
+package keymap
+
+import (
+	"fmt"
+	"github.com/gdamore/tcell/v2"
+	"strings"
+)
+
+// Action is something the user can do on the main screen with a key.
+type Action string
+
+const (
+	FocusNext     Action = "focus_next"
+	FocusPrevious Action = "focus_previous"
+	NextChat      Action = "next_chat"
+	PreviousChat  Action = "previous_chat"
+	AddFriend     Action = "add_friend"
+	EditFriend    Action = "edit_friend"
+	DeleteFriend  Action = "delete_friend"
+	Groups        Action = "groups"
+	AttachFile    Action = "attach_file"
+	Search        Action = "search"
+	MyDetails     Action = "my_details"
+	RawText       Action = "raw_text"
+	OpenEditor    Action = "open_editor"
+	Help          Action = "help"
+)
+
+// unbound disables an action's key when used in the config file.
+const unbound = "none"
+
+// Binding is an action together with the key it's bound to.
+type Binding struct {
+	Action      Action
+	Description string
+	Key         string
+}
+
+// defaults are the built-in bindings, in the order they're shown on the help screen.
+var defaults = []Binding{
+	{FocusNext, "focus the next part of the screen", "Tab"},
+	{FocusPrevious, "focus the previous part of the screen", "Shift+Tab"},
+	{NextChat, "open the next chat in the list", "Alt+Down"},
+	{PreviousChat, "open the previous chat in the list", "Alt+Up"},
+	{AddFriend, "add a friend", "Ctrl+N"},
+	{EditFriend, "edit the selected friend", "Ctrl+R"},
+	{DeleteFriend, "delete the selected friend", "Alt+d"},
+	{Groups, "manage groups", "Ctrl+G"},
+	{AttachFile, "send a file", "Ctrl+O"},
+	{Search, "search messages", "Ctrl+F"},
+	{MyDetails, "show your details", "Ctrl+P"},
+	{RawText, "show messages with or without formatting", "Ctrl+T"},
+	{OpenEditor, "write the message in your editor", "Alt+e"},
+	{Help, "show the keyboard shortcuts", "F1"},
+}
+
+// Keymap maps keys to actions.
+type Keymap struct {
+	bindings []Binding
+	keys     map[Action]Key
+}
+
+// New creates a Keymap from the default bindings, with the keys of some actions replaced by
+// overrides. An override of "none" unbinds the action.
+func New(overrides map[string]string) (*Keymap, error) {
+	m := &Keymap{bindings: make([]Binding, len(defaults)), keys: map[Action]Key{}}
+	copy(m.bindings, defaults)
+
+	for action := range overrides {
+		if !isAction(Action(action)) {
+			return nil, fmt.Errorf("unknown action %q", action)
+		}
+	}
+
+	boundTo := map[Key]Action{}
+
+	for i, binding := range m.bindings {
+		if key, ok := overrides[string(binding.Action)]; ok {
+			binding.Key = key
+		}
+
+		if strings.EqualFold(binding.Key, unbound) {
+			m.bindings[i].Key = ""
+			continue
+		}
+
+		key, err := Parse(binding.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", binding.Action, err)
+		}
+
+		if isTypingKey(key) {
+			return nil, fmt.Errorf("%s: %s is needed for typing messages, it can't be a shortcut", binding.Action, key)
+		}
+
+		if other, ok := boundTo[key]; ok {
+			return nil, fmt.Errorf("%s is bound to both %s and %s", key, other, binding.Action)
+		}
+
+		boundTo[key] = binding.Action
+		m.keys[binding.Action] = key
+		m.bindings[i].Key = key.String()
+	}
+
+	return m, nil
+}
+
+// Action returns the action bound to the key pressed in event.
+func (m *Keymap) Action(event *tcell.EventKey) (Action, bool) {
+	for action, key := range m.keys {
+		if key.Matches(event) {
+			return action, true
+		}
+	}
+
+	return "", false
+}
+
+// Bindings returns every action with its key, which is empty if the action is unbound.
+func (m *Keymap) Bindings() []Binding {
+	return m.bindings
+}
+
+// isTypingKey reports whether key would be taken from the message being typed: a character without Alt, or
+// one of the keys that edit the message. Terminals send Ctrl+H, Ctrl+I and Ctrl+M as Backspace, Tab and Enter.
+func isTypingKey(key Key) bool {
+	switch key.key {
+	case tcell.KeyRune:
+		return key.mods&tcell.ModAlt == 0
+	case tcell.KeyEnter, tcell.KeyCtrlJ, tcell.KeyBackspace, tcell.KeyBackspace2:
+		return true
+	case tcell.KeyTab:
+		// Tab itself moves the focus, but Ctrl+I would look like a different key
+		return key.mods&tcell.ModCtrl != 0
+	}
+
+	return false
+}
+
+func isAction(action Action) bool {
+	for _, binding := range defaults {
+		if binding.Action == action {
+			return true
+		}
+	}
+
+	return false
+}
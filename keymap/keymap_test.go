@@ -0,0 +1,40 @@
+package keymap
+
+import "testing"
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]string
+		valid     bool
+	}{
+		{"defaults", nil, true},
+		{"Ctrl and a letter", map[string]string{"add_friend": "Ctrl+A"}, true},
+		{"Alt and a letter", map[string]string{"add_friend": "Alt+a"}, true},
+		{"unbound", map[string]string{"groups": "none"}, true},
+		{"letter", map[string]string{"add_friend": "a"}, false},
+		{"Shift and a letter", map[string]string{"add_friend": "Shift+A"}, false},
+		{"punctuation", map[string]string{"help": "?"}, false},
+		{"space", map[string]string{"help": "Space"}, false},
+		{"Ctrl+M is Enter", map[string]string{"help": "Ctrl+M"}, false},
+		{"Ctrl+I is Tab", map[string]string{"help": "Ctrl+I"}, false},
+		{"Ctrl+H is Backspace", map[string]string{"help": "Ctrl+H"}, false},
+		{"Ctrl+J starts a new line", map[string]string{"help": "Ctrl+J"}, false},
+		{"Enter", map[string]string{"help": "Enter"}, false},
+		{"Alt+Enter starts a new line", map[string]string{"help": "Alt+Enter"}, false},
+		{"Backspace", map[string]string{"help": "Backspace"}, false},
+		{"Tab", map[string]string{"focus_next": "Tab"}, true},
+		{"Ctrl+Alt+M", map[string]string{"help": "Ctrl+Alt+M"}, false},
+		{"unknown action", map[string]string{"launch": "F2"}, false},
+		{"bound twice", map[string]string{"add_friend": "F1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.overrides)
+			if valid := err == nil; valid != tt.valid {
+				t.Errorf("got error %v, want valid %t", err, tt.valid)
+			}
+		})
+	}
+}
@@ -1,30 +1,122 @@
 package main
 
 import (
-	"github.com/XiovV/selly-client/data"
+	"flag"
+	"fmt"
+	"github.com/XiovV/selly-client/config"
 	"github.com/XiovV/selly-client/screens"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/rivo/tview"
+	"log"
 	"os"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+const usage = `Usage: selly [flags]
+
+Selly is a selfhostable, lightweight chatting service which runs in the terminal.
+
+Flags:
+`
+
+type options struct {
+	configPath   string
+	dbPath       string
+	profile      string
+	server       string
+	apiURL       string
+	websocketURL string
+	healthURL    string
+	version      bool
+}
+
 func main() {
-	var fileName string
+	opts := parseFlags()
 
-	if os.Args[1] == "1" {
-		fileName = "u1.db"
-	} else if os.Args[1] == "2" {
-		fileName = "u2.db"
-	} else if os.Args[1] == "3" {
-		fileName = "u3.db"
+	if opts.version {
+		fmt.Printf("selly %s\n", version)
+		return
 	}
 
-	db := data.NewRepository(fileName)
+	if opts.server != "" {
+		if err := config.Default().SetServer(opts.server); err != nil {
+			log.Fatalf("invalid --server: %s", err)
+		}
+	}
+
+	loader := &config.Loader{
+		Path:   opts.configPath,
+		Server: opts.server,
+		Overrides: config.Config{
+			APIURL:       opts.apiURL,
+			WebsocketURL: opts.websocketURL,
+			HealthURL:    opts.healthURL,
+		},
+	}
+
+	profile, err := opts.selectedProfile()
+	if err != nil {
+		log.Fatalf("couldn't open profile: %s", err)
+	}
 
 	app := tview.NewApplication()
-	root := screens.NewApp(app, db)
+	root := screens.NewApp(app, loader, profile)
 
 	if err := app.SetRoot(root.Start(), true).EnableMouse(true).Run(); err != nil {
 		panic(err)
 	}
 }
+
+func parseFlags() options {
+	var opts options
+
+	defaultConfigPath, _ := config.DefaultPath()
+	if envPath := os.Getenv("SELLY_CONFIG"); envPath != "" {
+		defaultConfigPath = envPath
+	}
+
+	flag.StringVar(&opts.configPath, "config", defaultConfigPath, "path to the config file")
+	flag.StringVar(&opts.dbPath, "db", "", "path to the database, overrides --profile")
+	flag.StringVar(&opts.profile, "profile", "", "name of the profile to use, you get to pick one on startup if not set")
+	flag.StringVar(&opts.server, "server", "", "host of the Selly instance, e.g. selly.example.com or https://selly.example.com")
+	flag.StringVar(&opts.apiURL, "api-url", "", "base URL of the Selly API")
+	flag.StringVar(&opts.websocketURL, "websocket-url", "", "URL of the Selly chat websocket")
+	flag.StringVar(&opts.healthURL, "health-url", "", "URL used to check if the Selly server is reachable")
+	flag.BoolVar(&opts.version, "version", false, "print the version and exit")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		fmt.Fprintf(flag.CommandLine.Output(), "unexpected argument: %s\n\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	return opts
+}
+
+// selectedProfile returns the profile chosen on the command line, or nil if the user should pick one.
+func (o options) selectedProfile() (*config.Profile, error) {
+	if o.dbPath != "" {
+		profile := config.DatabaseProfile(o.dbPath)
+		return &profile, nil
+	}
+
+	if o.profile != "" {
+		profile, err := config.OpenProfile(o.profile)
+		if err != nil {
+			return nil, err
+		}
+
+		return &profile, nil
+	}
+
+	return nil, nil
+}
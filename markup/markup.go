@@ -0,0 +1,200 @@
+package markup
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Format is the formatting of a Span, several formats can be combined, e.g. Bold|Italic.
+type Format int
+
+const (
+	Bold Format = 1 << iota
+	Italic
+	Code
+	Link
+)
+
+// Span is a piece of a line that's formatted the same way throughout.
+type Span struct {
+	Text   string
+	Format Format
+}
+
+// Line is a line of a message. Lines of code blocks hold a single span with the line as it was written.
+type Line struct {
+	Spans     []Span
+	Quote     bool
+	CodeBlock bool
+}
+
+const fence = "```"
+
+// Parse splits text into lines and finds the formatting in them: *bold*, _italic_, `code`, code blocks
+// between lines starting with ```, quotes starting with > and http(s) URLs. A backslash in front of
+// *, _ or ` shows it as it is. Markers that aren't closed are shown as they are.
+func Parse(text string) []Line {
+	var lines []Line
+	inCodeBlock := false
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), fence) {
+			inCodeBlock = !inCodeBlock
+			continue
+		}
+
+		if inCodeBlock {
+			lines = append(lines, Line{Spans: []Span{{Text: line, Format: Code}}, CodeBlock: true})
+			continue
+		}
+
+		quote := strings.HasPrefix(line, ">")
+		if quote {
+			line = strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")
+		}
+
+		lines = append(lines, Line{Spans: parseInline(line, 0), Quote: quote})
+	}
+
+	return lines
+}
+
+// parseInline finds the formatting in s, every span gets format on top of its own.
+func parseInline(s string, format Format) []Span {
+	var spans []Span
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			spans = append(spans, Span{Text: text.String(), Format: format})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("*_`\\", s[i+1]) != -1:
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+		case c == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				flush()
+				spans = append(spans, Span{Text: s[i+1 : i+1+end], Format: format | Code})
+				i += end + 2
+				continue
+			}
+		case c == 'h' && isURLStart(s, i):
+			end := urlEnd(s, i)
+
+			flush()
+			spans = append(spans, Span{Text: s[i:end], Format: format | Link})
+			i = end
+			continue
+		case c == '*' || c == '_':
+			// doubled delimiters like **bold** work the same as single ones
+			delimiter := s[i : i+1]
+			if strings.HasPrefix(s[i:], strings.Repeat(delimiter, 2)) {
+				delimiter += delimiter
+			}
+
+			if end := closingDelimiter(s, i, delimiter); end != -1 && canOpen(s, i, delimiter) {
+				emphasis := Bold
+				if c == '_' {
+					emphasis = Italic
+				}
+
+				flush()
+				spans = append(spans, parseInline(s[i+len(delimiter):end], format|emphasis)...)
+				i = end + len(delimiter)
+				continue
+			}
+
+			text.WriteString(delimiter)
+			i += len(delimiter)
+			continue
+		}
+
+		text.WriteByte(c)
+		i++
+	}
+
+	flush()
+
+	return spans
+}
+
+func isURLStart(s string, i int) bool {
+	if i > 0 && isWordRune(lastRune(s[:i])) {
+		return false
+	}
+
+	rest := s[i:]
+	for _, scheme := range []string{"https://", "http://"} {
+		if strings.HasPrefix(rest, scheme) && len(rest) > len(scheme) && !unicode.IsSpace(firstRune(rest[len(scheme):])) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// urlEnd returns where the URL starting at i ends. Punctuation at the end, like the full stop of a sentence,
+// isn't part of it.
+func urlEnd(s string, i int) int {
+	end := strings.IndexFunc(s[i:], unicode.IsSpace)
+	if end == -1 {
+		end = len(s)
+	} else {
+		end += i
+	}
+
+	for end > i && strings.IndexByte(".,;:!?)]'\"*_", s[end-1]) != -1 {
+		end--
+	}
+
+	return end
+}
+
+// canOpen reports whether the delimiter at i can start emphasis: it mustn't be inside a word, like in
+// snake_case, and must be followed by text.
+func canOpen(s string, i int, delimiter string) bool {
+	after := i + len(delimiter)
+	if after >= len(s) || unicode.IsSpace(firstRune(s[after:])) {
+		return false
+	}
+
+	return i == 0 || !isWordRune(lastRune(s[:i]))
+}
+
+// closingDelimiter returns the index of the delimiter closing the one at open, or -1 if there is none.
+func closingDelimiter(s string, open int, delimiter string) int {
+	for i := open + len(delimiter) + 1; i+len(delimiter) <= len(s); i++ {
+		if !strings.HasPrefix(s[i:], delimiter) || s[i-1] == '\\' || unicode.IsSpace(lastRune(s[:i])) {
+			continue
+		}
+
+		if after := i + len(delimiter); after == len(s) || !isWordRune(firstRune(s[after:])) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
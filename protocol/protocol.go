@@ -0,0 +1,195 @@
+// Package protocol defines the payloads exchanged with other clients over the websocket.
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Version of the protocol spoken by this client. It's bumped whenever a change to an existing
+// payload isn't backwards compatible, adding new payload types doesn't require a new version.
+const Version = 1
+
+type Type string
+
+const (
+	TypeMessage     Type = "message"
+	TypeAck         Type = "ack"
+	TypeTyping      Type = "typing"
+	TypePresence    Type = "presence"
+	TypeError       Type = "error"
+	TypeKeyExchange Type = "key_exchange"
+	TypeGroup       Type = "group"
+)
+
+var ErrMalformedEnvelope = errors.New("malformed envelope")
+
+// UnsupportedVersionError is returned by Decode for envelopes sent with a newer version of the protocol,
+// which this client can't be sure to understand.
+type UnsupportedVersionError struct {
+	Type    Type
+	Version int
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("%q payload uses protocol version %d, this client only supports up to version %d", e.Type, e.Version, Version)
+}
+
+// Envelope wraps every payload sent over the websocket. Msg holds the payload itself and is
+// decoded once the handler for Type is known.
+type Envelope struct {
+	Version int             `json:"Version,omitempty"`
+	Type    Type            `json:"Type"`
+	Msg     json.RawMessage `json:"Msg"`
+}
+
+// NewEnvelope encodes msg into an envelope of the given type.
+func NewEnvelope(t Type, msg interface{}) (Envelope, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{Version: Version, Type: t, Msg: body}, nil
+}
+
+// Encode returns the JSON encoding of msg wrapped in an envelope of the given type.
+func Encode(t Type, msg interface{}) ([]byte, error) {
+	envelope, err := NewEnvelope(t, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(envelope)
+}
+
+// Decode parses an envelope without decoding its payload. Envelopes without a version were sent
+// by clients that predate versioning and are treated as version 1, envelopes with a newer version
+// than Version are rejected with an *UnsupportedVersionError.
+func Decode(data []byte) (Envelope, error) {
+	var envelope Envelope
+
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return Envelope{}, ErrMalformedEnvelope
+	}
+
+	if envelope.Type == "" {
+		return Envelope{}, ErrMalformedEnvelope
+	}
+
+	if envelope.Version == 0 {
+		envelope.Version = 1
+	}
+
+	if envelope.Version > Version {
+		return Envelope{}, &UnsupportedVersionError{Type: envelope.Type, Version: envelope.Version}
+	}
+
+	return envelope, nil
+}
+
+// DecodeMsg decodes the payload of the envelope into v.
+func (e Envelope) DecodeMsg(v interface{}) error {
+	return json.Unmarshal(e.Msg, v)
+}
+
+// Message is a chat message. Messages to a group are sent to each of its members separately,
+// with GroupID set. Attachment holds an Attachment encoded as JSON and encrypted like Message.
+type Message struct {
+	ID          string `json:"id"`
+	Sender      string `json:"sender"`
+	Receiver    string `json:"receiver"`
+	Message     string `json:"message"`
+	DateCreated int64  `json:"date_crated"`
+	GroupID     string `json:"group_id,omitempty"`
+	Attachment  string `json:"attachment,omitempty"`
+}
+
+// Attachment describes a file uploaded through the API, Key decrypts it.
+type Attachment struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	Key  string `json:"key"`
+}
+
+type AckStatus string
+
+const (
+	AckDelivered AckStatus = "delivered"
+	AckRead      AckStatus = "read"
+)
+
+// Ack acknowledges that messages have been delivered to or read by Sender.
+type Ack struct {
+	Sender     string    `json:"sender"`
+	Receiver   string    `json:"receiver"`
+	MessageIDs []string  `json:"message_ids"`
+	Status     AckStatus `json:"status"`
+}
+
+// Typing tells Receiver whether Sender is currently typing a message to them.
+type Typing struct {
+	Sender   string `json:"sender"`
+	Receiver string `json:"receiver"`
+	Typing   bool   `json:"typing"`
+}
+
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceAway    PresenceStatus = "away"
+	PresenceOffline PresenceStatus = "offline"
+)
+
+// Presence tells Receiver whether Sender is online. LastSeen is the unix time Sender was last online,
+// it's set by the server. Presence sent without a Receiver goes to all of Sender's friends.
+type Presence struct {
+	Sender   string         `json:"sender"`
+	Receiver string         `json:"receiver,omitempty"`
+	Status   PresenceStatus `json:"status"`
+	LastSeen int64          `json:"last_seen,omitempty"`
+}
+
+// Error is sent by the server when it couldn't process a payload.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// KeyExchange is sent to a friend so they can encrypt messages for us. If Request is set,
+// the sender doesn't know the receiver's key yet and expects one in return.
+type KeyExchange struct {
+	Sender    string `json:"sender"`
+	Receiver  string `json:"receiver"`
+	PublicKey string `json:"public_key"`
+	Request   bool   `json:"request"`
+}
+
+type GroupAction string
+
+const (
+	// GroupInvite carries the name and full member list of a group, it's sent to every member by the
+	// group's creator whenever they invite someone. Invites from other members are ignored.
+	GroupInvite GroupAction = "invite"
+	// GroupLeave is sent to every member by a member leaving the group.
+	GroupLeave GroupAction = "leave"
+)
+
+type GroupMember struct {
+	SellyID   string `json:"selly_id"`
+	PublicKey string `json:"public_key"`
+}
+
+// Group tells Receiver about a change to one of their groups. GroupID is 32 random lower case hex
+// characters, invites with any other ID are rejected.
+type Group struct {
+	Sender   string        `json:"sender"`
+	Receiver string        `json:"receiver"`
+	Action   GroupAction   `json:"action"`
+	GroupID  string        `json:"group_id"`
+	Name     string        `json:"name,omitempty"`
+	Members  []GroupMember `json:"members,omitempty"`
+}
@@ -0,0 +1,177 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// payloads holds an example of every payload type, decoding one must give back what was encoded.
+var payloads = map[Type]interface{}{
+	TypeMessage: &Message{
+		ID:          "message-id",
+		Sender:      "alice",
+		Receiver:    "bob",
+		Message:     "hello",
+		DateCreated: 1650000000,
+		GroupID:     "group-id",
+		Attachment:  "encrypted attachment",
+	},
+	TypeAck: &Ack{
+		Sender:     "bob",
+		Receiver:   "alice",
+		MessageIDs: []string{"first", "second"},
+		Status:     AckRead,
+	},
+	TypeTyping: &Typing{
+		Sender:   "alice",
+		Receiver: "bob",
+		Typing:   true,
+	},
+	TypePresence: &Presence{
+		Sender:   "alice",
+		Receiver: "bob",
+		Status:   PresenceAway,
+		LastSeen: 1650000000,
+	},
+	TypeError: &Error{
+		Code:    "unknown_receiver",
+		Message: "the receiver doesn't exist",
+	},
+	TypeKeyExchange: &KeyExchange{
+		Sender:    "alice",
+		Receiver:  "bob",
+		PublicKey: "public key",
+		Request:   true,
+	},
+	TypeGroup: &Group{
+		Sender:   "alice",
+		Receiver: "bob",
+		Action:   GroupInvite,
+		GroupID:  "group-id",
+		Name:     "friends",
+		Members:  []GroupMember{{SellyID: "alice", PublicKey: "alice's key"}, {SellyID: "bob", PublicKey: "bob's key"}},
+	},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for typ, payload := range payloads {
+		t.Run(string(typ), func(t *testing.T) {
+			data, err := Encode(typ, payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			envelope, err := Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if envelope.Type != typ || envelope.Version != Version {
+				t.Errorf("got type %q version %d, want %q version %d", envelope.Type, envelope.Version, typ, Version)
+			}
+
+			decoded := reflect.New(reflect.TypeOf(payload).Elem()).Interface()
+			if err := envelope.DecodeMsg(decoded); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(decoded, payload) {
+				t.Errorf("got %+v, want %+v", decoded, payload)
+			}
+		})
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	registry := NewRegistry()
+
+	var got Typing
+	registry.Handle(TypeTyping, func(envelope Envelope) error {
+		return envelope.DecodeMsg(&got)
+	})
+
+	data, err := Encode(TypeTyping, payloads[TypeTyping])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := registry.Dispatch(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&got, payloads[TypeTyping]) {
+		t.Errorf("got %+v, want %+v", got, payloads[TypeTyping])
+	}
+}
+
+func TestDispatchHandlerError(t *testing.T) {
+	registry := NewRegistry()
+
+	errHandler := errors.New("handler failed")
+	registry.Handle(TypeAck, func(Envelope) error {
+		return errHandler
+	})
+
+	if err := registry.Dispatch([]byte(`{"Version":1,"Type":"ack","Msg":{}}`)); !errors.Is(err, errHandler) {
+		t.Errorf("got %v, want %v", err, errHandler)
+	}
+}
+
+func TestDispatchUnknownType(t *testing.T) {
+	err := NewRegistry().Dispatch([]byte(`{"Version":1,"Type":"reaction","Msg":{}}`))
+
+	var unknownType *UnknownTypeError
+	if !errors.As(err, &unknownType) || unknownType.Type != "reaction" {
+		t.Errorf("got %v, want an *UnknownTypeError for reaction", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		version int
+		err     error
+	}{
+		{"current version", `{"Version":1,"Type":"message","Msg":{}}`, 1, nil},
+		{"without a version", `{"Type":"message","Msg":{}}`, 1, nil},
+		{"newer version", `{"Version":2,"Type":"message","Msg":{}}`, 0, &UnsupportedVersionError{Type: TypeMessage, Version: 2}},
+		{"without a type", `{"Version":1,"Msg":{}}`, 0, ErrMalformedEnvelope},
+		{"not JSON", `message`, 0, ErrMalformedEnvelope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envelope, err := Decode([]byte(tt.data))
+			if !reflect.DeepEqual(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			if envelope.Version != tt.version {
+				t.Errorf("got version %d, want %d", envelope.Version, tt.version)
+			}
+		})
+	}
+}
+
+func TestDispatchNewerVersion(t *testing.T) {
+	registry := NewRegistry()
+
+	called := false
+	registry.Handle(TypeMessage, func(Envelope) error {
+		called = true
+		return nil
+	})
+
+	err := registry.Dispatch([]byte(`{"Version":2,"Type":"message","Msg":{}}`))
+
+	var unsupportedVersion *UnsupportedVersionError
+	if !errors.As(err, &unsupportedVersion) {
+		t.Errorf("got %v, want an *UnsupportedVersionError", err)
+	}
+
+	if called {
+		t.Error("the handler was called for a newer version")
+	}
+}
@@ -0,0 +1,58 @@
+package protocol
+
+import (
+	"fmt"
+	"sync"
+)
+
+// HandlerFunc handles a decoded envelope of the type it was registered for.
+type HandlerFunc func(Envelope) error
+
+// UnknownTypeError is returned by Dispatch for payload types without a registered handler,
+// usually because they were introduced by a newer client or server.
+type UnknownTypeError struct {
+	Type    Type
+	Version int
+}
+
+func (e *UnknownTypeError) Error() string {
+	return fmt.Sprintf("unknown payload type %q (version %d)", e.Type, e.Version)
+}
+
+// Registry routes incoming envelopes to the handler registered for their type.
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[Type]HandlerFunc
+}
+
+func NewRegistry() *Registry {
+	return &Registry{handlers: map[Type]HandlerFunc{}}
+}
+
+// Handle registers the handler for payloads of type t, replacing the previous one.
+func (r *Registry) Handle(t Type, handler HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handlers[t] = handler
+}
+
+// Dispatch decodes data and passes it to the matching handler. Unknown types are reported
+// with an *UnknownTypeError and newer versions with an *UnsupportedVersionError, they're
+// otherwise ignored.
+func (r *Registry) Dispatch(data []byte) error {
+	envelope, err := Decode(data)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	handler, ok := r.handlers[envelope.Type]
+	r.mu.RUnlock()
+
+	if !ok {
+		return &UnknownTypeError{Type: envelope.Type, Version: envelope.Version}
+	}
+
+	return handler(envelope)
+}
@@ -1,30 +1,50 @@
 package screens
 
 import (
+	"database/sql"
+	"errors"
+	"github.com/XiovV/selly-client/config"
 	"github.com/XiovV/selly-client/data"
+	"github.com/XiovV/selly-client/theme"
 	"github.com/XiovV/selly-client/ws"
 	"github.com/rivo/tview"
 	"log"
+	"time"
 )
 
 type App struct {
 	app           *tview.Application
 	db            *data.Repository
+	cfg           *config.Config
+	theme         *theme.Theme
+	loader        *config.Loader
+	profile       *config.Profile
 	startupScreen *Startup
 	mainScreen    *Main
+	idle          *idleWatcher
+	isLocked      bool
 }
 
-func NewApp(app *tview.Application, db *data.Repository) *App {
-	return &App{app: app, db: db}
+// NewApp creates the root of the application. If profile is nil, the user gets to pick one on startup.
+func NewApp(app *tview.Application, loader *config.Loader, profile *config.Profile) *App {
+	a := &App{app: app, loader: loader, profile: profile, idle: newIdleWatcher(app)}
+
+	go a.watchIdleTime()
+
+	return a
 }
 
 func (a *App) showConnectionFailedMessage() tview.Primitive {
 	modal := tview.NewModal().
 		SetText("Connection could not be established with the server, please check your internet connection or try again later.").
-		AddButtons([]string{"Okay", "Quit"}).
+		AddButtons([]string{"Okay", "Switch Profile", "Quit"}).
 		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 			if buttonLabel == "Okay" {
-				a.app.SetRoot(NewMainScreen(a.app, a.db).Render(), true)
+				a.showMainScreen()
+			}
+
+			if buttonLabel == "Switch Profile" {
+				a.showProfilePicker()
 			}
 
 			if buttonLabel == "Quit" {
@@ -36,19 +56,186 @@ func (a *App) showConnectionFailedMessage() tview.Primitive {
 }
 
 func (a *App) Start() tview.Primitive {
+	if a.profile == nil {
+		profiles, err := config.ListProfiles()
+		if err != nil {
+			log.Fatalf("couldn't list profiles: %s", err)
+		}
+
+		if len(profiles) > 1 {
+			return NewProfilePicker(a.app, profiles, a.switchProfile, nil).Render()
+		}
+
+		profile, err := config.OpenProfile(config.DefaultProfile)
+		if err != nil {
+			log.Fatalf("couldn't open profile: %s", err)
+		}
+
+		if len(profiles) == 1 {
+			profile = profiles[0]
+		}
+
+		a.profile = &profile
+	}
+
+	if err := a.openProfile(*a.profile); err != nil {
+		log.Fatalf("couldn't open profile %s: %s", a.profile.Name, err)
+	}
+
+	return a.unlockAndStartSession()
+}
+
+// unlockAndStartSession asks for the passphrase first if the profile's database is protected by one.
+func (a *App) unlockAndStartSession() tview.Primitive {
+	if a.db.HasPassphrase() {
+		return NewLockScreen(a.app, a.db, func() {
+			a.app.SetRoot(a.startSession(), true)
+		}).Render()
+	}
+
+	return a.startSession()
+}
+
+func (a *App) startSession() tview.Primitive {
 	if a.isAccountSetUp() {
-		if !ws.Ping() {
+		if !ws.Ping(a.cfg.HealthURL) {
 			return a.showConnectionFailedMessage()
 		}
 
-		return NewMainScreen(a.app, a.db).Render()
+		return a.newMainScreen().Render()
 	}
 
-	return NewStartupScreen(a.app, a.db).Render()
+	a.startupScreen = NewStartupScreen(a.app, a.db, a.cfg, a.theme, a.showMainScreen)
+
+	return a.startupScreen.Render()
+}
+
+func (a *App) newMainScreen() *Main {
+	a.mainScreen = NewMainScreen(a.app, a.db, a.cfg, a.theme)
+	a.mainScreen.SetSwitchProfileFunc(a.showProfilePicker)
+
+	return a.mainScreen
+}
+
+func (a *App) showMainScreen() {
+	a.app.SetRoot(a.newMainScreen().Render(), true)
+}
+
+func (a *App) showProfilePicker() {
+	profiles, err := config.ListProfiles()
+	if err != nil {
+		log.Fatalf("couldn't list profiles: %s", err)
+	}
+
+	var onCancel func()
+	if a.mainScreen != nil {
+		onCancel = func() {
+			a.app.SetRoot(a.mainScreen.Render(), true)
+		}
+	}
+
+	a.app.SetRoot(NewProfilePicker(a.app, profiles, a.switchProfile, onCancel).Render(), true)
+}
+
+// switchProfile closes the session of the current profile, if any, and starts a new one for profile.
+func (a *App) switchProfile(profile config.Profile) error {
+	if err := a.openProfile(profile); err != nil {
+		return err
+	}
+
+	a.app.SetRoot(a.unlockAndStartSession(), true)
+
+	return nil
+}
+
+func (a *App) openProfile(profile config.Profile) error {
+	cfg, err := a.loader.Load(profile)
+	if err != nil {
+		return err
+	}
+
+	t, err := cfg.LoadTheme()
+	if err != nil {
+		return err
+	}
+
+	a.closeSession()
+
+	// the theme has to be applied before the profile's screens are created
+	t.Apply()
+
+	a.profile = &profile
+	a.cfg = cfg
+	a.theme = t
+	a.db = data.NewRepository(profile.Database)
+
+	return nil
+}
+
+func (a *App) closeSession() {
+	if a.mainScreen != nil {
+		a.mainScreen.Close()
+		a.mainScreen = nil
+	}
+
+	if a.db != nil {
+		a.db.Close()
+		a.db = nil
+	}
+
+	a.startupScreen = nil
+}
+
+func (a *App) watchIdleTime() {
+	for range time.Tick(10 * time.Second) {
+		a.app.QueueUpdateDraw(func() {
+			a.updateAway()
+			a.lockIfIdle()
+		})
+	}
+}
+
+// updateAway shows the user as away to their friends while the client is idle.
+func (a *App) updateAway() {
+	if a.mainScreen == nil {
+		return
+	}
+
+	awayAfter := a.cfg.AwayAfterDuration()
+	a.mainScreen.SetAway(awayAfter != 0 && a.idle.idleFor() >= awayAfter)
+}
+
+// lockIfIdle shows the lock screen if the main screen has been idle for longer than the configured time.
+// Only profiles protected by a passphrase are locked.
+func (a *App) lockIfIdle() {
+	if a.isLocked || a.mainScreen == nil || !a.db.HasPassphrase() {
+		return
+	}
+
+	lockAfter := a.cfg.LockAfterDuration()
+	if lockAfter == 0 || a.idle.idleFor() < lockAfter {
+		return
+	}
+
+	a.isLocked = true
+
+	// the session is paused and the key dropped, so nothing is decrypted while the client is locked
+	a.mainScreen.Pause()
+	a.db.Lock()
+
+	a.app.SetRoot(NewLockScreen(a.app, a.db, func() {
+		a.isLocked = false
+		a.mainScreen.Resume()
+		a.app.SetRoot(a.mainScreen.Render(), true)
+	}).Render(), true)
 }
 
 func (a *App) isAccountSetUp() bool {
 	_, err := a.db.GetLocalUserInfo()
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+
 	if err != nil {
 		log.Fatal(err)
 		return false
@@ -0,0 +1,417 @@
+package screens
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/XiovV/selly-client/attachment"
+	"github.com/XiovV/selly-client/data"
+	"github.com/XiovV/selly-client/e2e"
+	"github.com/XiovV/selly-client/protocol"
+	"github.com/rivo/tview"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errAttachmentPending    = errors.New("attachment hasn't been uploaded yet")
+	errAttachmentUnreadable = errors.New("the file can't be read anymore")
+)
+
+func (s *Main) showFilePicker() {
+	if s.conversationID() == "" {
+		return
+	}
+
+	root, err := os.UserHomeDir()
+	if err != nil {
+		root = "."
+	}
+
+	picker := NewFilePicker(root, s.theme.Accent.Color(), func(path string) {
+		s.app.SetRoot(s.Render(), true)
+
+		if err := s.sendAttachment(path); err != nil {
+			s.addErrorMessage(err.Error())
+		}
+	}, func() {
+		s.app.SetRoot(s.Render(), true)
+	})
+
+	s.app.SetRoot(picker.Render(), true)
+}
+
+// sendAttachment queues a message carrying the file at path to the selected conversation. The message
+// is held back in the outbox until the file has been uploaded.
+func (s *Main) sendAttachment(path string) error {
+	conversation := s.conversationID()
+	if conversation == "" {
+		return errors.New("select a friend or a group to send the file to")
+	}
+
+	path, err := expandPath(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+
+	key, err := attachment.NewKey()
+	if err != nil {
+		return err
+	}
+
+	message := data.Message{
+		ID:         data.NewMessageID(),
+		Sender:     s.localUser.SellyID,
+		Receiver:   conversation,
+		Message:    info.Name(),
+		DateCrated: time.Now().Unix(),
+		Read:       1,
+		IsGroup:    s.selectedGroup != nil,
+	}
+
+	_, err = s.db.StoreAttachment(data.Attachment{
+		MessageID: message.ID,
+		Name:      info.Name(),
+		Size:      info.Size(),
+		Key:       key.String(),
+		Path:      path,
+		Outgoing:  true,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.QueueMessage(conversation, message); err != nil {
+		return err
+	}
+
+	s.moveConversationToTop()
+	s.reloadMessages()
+	s.updateStatusBar()
+
+	go s.uploadPendingAttachments()
+
+	return nil
+}
+
+// uploadPendingAttachments uploads every attachment that hasn't been uploaded completely, resuming
+// interrupted uploads, and then sends the messages they belong to.
+func (s *Main) uploadPendingAttachments() {
+	pending, err := s.db.GetPendingUploads()
+	if err != nil {
+		return
+	}
+
+	for _, a := range pending {
+		if !s.startTransfer(a.ID) {
+			continue
+		}
+
+		err := s.uploadAttachment(a)
+		s.finishTransfer(a.ID)
+
+		// a file that was moved or changed won't come back, so its message isn't retried
+		if errors.Is(err, errAttachmentUnreadable) {
+			if markErr := s.db.MarkFailed(a.MessageID); markErr != nil {
+				err = markErr
+			} else {
+				name := a.Name
+				s.app.QueueUpdateDraw(func() {
+					s.reloadMessages()
+					s.addErrorMessage(fmt.Sprintf("couldn't send %s: %s", name, err))
+				})
+
+				continue
+			}
+		}
+
+		if err != nil {
+			name := a.Name
+			s.app.QueueUpdateDraw(func() {
+				s.addErrorMessage(fmt.Sprintf("couldn't upload %s, it will be retried once you're reconnected: %s", name, err))
+			})
+		}
+	}
+
+	// messages are sent from the UI goroutine, like everything else that touches the chat
+	s.app.QueueUpdateDraw(func() {
+		if s.flushOutbox() {
+			s.reloadMessages()
+		}
+	})
+}
+
+// uploadAttachment uploads the file of an attachment, it returns an error wrapping errAttachmentUnreadable if
+// the file is gone or has changed since it was sent.
+func (s *Main) uploadAttachment(a data.Attachment) error {
+	file, err := os.Open(a.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errAttachmentUnreadable, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("%w: %s", errAttachmentUnreadable, err)
+	}
+
+	if info.Size() != a.Size {
+		return fmt.Errorf("%w: it has changed since it was sent", errAttachmentUnreadable)
+	}
+
+	key, err := attachment.ParseKey(a.Key)
+	if err != nil {
+		return err
+	}
+
+	if a.UploadID == "" {
+		a.UploadID, err = s.attachments.Create(a.Size)
+		if err != nil {
+			return err
+		}
+
+		if err := s.db.SetUploadID(a.ID, a.UploadID); err != nil {
+			return err
+		}
+	}
+
+	err = s.attachments.Upload(a.UploadID, file, a.Size, key, func(uploaded int64) {
+		s.showTransfer(fmt.Sprintf("uploading %s %d%%", a.Name, percent(uploaded, a.Size)))
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.db.MarkUploaded(a.ID)
+}
+
+// saveAttachment downloads a received attachment into the downloads directory in the background.
+func (s *Main) saveAttachment(id int64) error {
+	a, err := s.db.GetAttachment(id)
+	if err != nil || a.Outgoing {
+		return fmt.Errorf("there's no received attachment with the number %d", id)
+	}
+
+	key, err := attachment.ParseKey(a.Key)
+	if err != nil {
+		return err
+	}
+
+	dir, err := s.cfg.DownloadsPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	if !s.startTransfer(a.ID) {
+		return fmt.Errorf("%s is already being downloaded", a.Name)
+	}
+
+	go func() {
+		defer s.finishTransfer(a.ID)
+
+		s.showTransfer(fmt.Sprintf("downloading %s", a.Name))
+
+		path, err := s.downloadAttachment(a, key, dir)
+
+		s.app.QueueUpdateDraw(func() {
+			if err != nil {
+				s.addErrorMessage(fmt.Sprintf("couldn't download %s: %s", a.Name, err))
+				return
+			}
+
+			s.reloadMessages()
+			s.addNoticeMessage(fmt.Sprintf("saved %s to %s", a.Name, path))
+		})
+	}()
+
+	return nil
+}
+
+// downloadAttachment downloads the attachment next to its final location first, so an interrupted
+// download never leaves a partial file behind under the real name.
+func (s *Main) downloadAttachment(a data.Attachment, key attachment.Key, dir string) (string, error) {
+	path := availablePath(filepath.Join(dir, a.Name))
+
+	file, err := os.OpenFile(path+".part", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.attachments.Download(a.UploadID, key, a.Size, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(path + ".part")
+		return "", err
+	}
+
+	if err := os.Rename(path+".part", path); err != nil {
+		return "", err
+	}
+
+	return path, s.db.SetAttachmentPath(a.ID, path)
+}
+
+// startTransfer marks the attachment as being transferred, it returns false if it already is.
+func (s *Main) startTransfer(id int64) bool {
+	s.transfersMu.Lock()
+	defer s.transfersMu.Unlock()
+
+	if s.transfers[id] {
+		return false
+	}
+
+	s.transfers[id] = true
+
+	return true
+}
+
+func (s *Main) finishTransfer(id int64) {
+	s.transfersMu.Lock()
+	delete(s.transfers, id)
+	s.transfersMu.Unlock()
+
+	s.showTransfer("")
+}
+
+// showTransfer shows the progress of a transfer in the status bar, it's called from the goroutine
+// making the transfer.
+func (s *Main) showTransfer(text string) {
+	s.app.QueueUpdateDraw(func() {
+		s.statusBar.setTransfer(text)
+		s.updateStatusBar()
+	})
+}
+
+// wireAttachment returns the attachment of an outgoing message encoded for the protocol, or an empty
+// string if the message has none. If the attachment can't be read, the error is returned so the message
+// isn't sent without it.
+func (s *Main) wireAttachment(messageId string) (string, error) {
+	a, err := s.db.GetAttachmentByMessageID(messageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if !a.Uploaded {
+		return "", errAttachmentPending
+	}
+
+	encoded, err := json.Marshal(protocol.Attachment{ID: a.UploadID, Name: a.Name, Size: a.Size, Key: a.Key})
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+// storeReceivedAttachment decrypts the attachment of an incoming message and stores it, so the file can
+// be saved later.
+func (s *Main) storeReceivedAttachment(msg protocol.Message, publicKey string) (data.Attachment, error) {
+	decrypted, err := e2e.Decrypt(msg.Attachment, publicKey, s.localUser.PrivateKey)
+	if err != nil {
+		return data.Attachment{}, err
+	}
+
+	var wire protocol.Attachment
+	if err := json.Unmarshal([]byte(decrypted), &wire); err != nil {
+		return data.Attachment{}, err
+	}
+
+	a := data.Attachment{
+		MessageID: msg.ID,
+		UploadID:  wire.ID,
+		Name:      safeFileName(wire.Name),
+		Size:      wire.Size,
+		Key:       wire.Key,
+	}
+
+	a.ID, err = s.db.StoreAttachment(a)
+
+	return a, err
+}
+
+// attachmentText returns the placeholder shown in the chat instead of the text of a message with an attachment.
+func (s *Main) attachmentText(a data.Attachment) string {
+	text := fmt.Sprintf("%s📎 %s%s (%s)", s.theme.Accent.Tag(), tview.Escape(a.Name), s.theme.Muted.Tag(), attachment.FormatSize(a.Size))
+
+	switch {
+	case a.Outgoing && !a.Uploaded:
+		text += " uploading…"
+	case !a.Outgoing && a.Path != "":
+		text += " saved to " + tview.Escape(a.Path)
+	case !a.Outgoing:
+		text += " /save " + strconv.FormatInt(a.ID, 10)
+	}
+
+	return text + s.theme.Text.Tag()
+}
+
+// expandPath expands a leading ~ to the home directory and makes path absolute.
+func expandPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+
+		path = filepath.Join(home, path[1:])
+	}
+
+	return filepath.Abs(path)
+}
+
+// safeFileName strips anything from a received file name that could place it outside the downloads directory.
+func safeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+
+	if name == "." || name == ".." || name == "/" || name == "" {
+		return "attachment"
+	}
+
+	return name
+}
+
+// availablePath returns path, or path with a number appended to its name if a file already exists there.
+func availablePath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+
+		path = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+func percent(n, total int64) int64 {
+	if total == 0 {
+		return 100
+	}
+
+	return n * 100 / total
+}
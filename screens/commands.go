@@ -0,0 +1,411 @@
+package screens
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// command is run by typing a slash followed by its name into the message input, e.g. "/rename bob robert".
+type command struct {
+	name        string
+	usage       string
+	description string
+
+	// complete returns the candidates for the argument at index, it may be nil.
+	complete func(index int) []string
+	run      func(args string) error
+}
+
+// commandRegistry holds the commands in the order they were registered, which is how /help lists them.
+type commandRegistry struct {
+	commands []*command
+	byName   map[string]*command
+}
+
+func newCommandRegistry() *commandRegistry {
+	return &commandRegistry{byName: map[string]*command{}}
+}
+
+func (r *commandRegistry) register(c command) {
+	r.commands = append(r.commands, &c)
+	r.byName[c.name] = &c
+}
+
+func (r *commandRegistry) get(name string) (*command, bool) {
+	c, ok := r.byName[strings.TrimPrefix(name, "/")]
+
+	return c, ok
+}
+
+func (r *commandRegistry) names() []string {
+	names := make([]string, len(r.commands))
+	for i, c := range r.commands {
+		names[i] = "/" + c.name
+	}
+
+	return names
+}
+
+func (s *Main) registerCommands() {
+	s.commands = newCommandRegistry()
+
+	s.commands.register(command{
+		name:        "help",
+		usage:       "/help",
+		description: "show all commands",
+		run: func(string) error {
+			for _, c := range s.commands.commands {
+				s.addNoticeMessage(fmt.Sprintf("%-28s %s", c.usage, c.description))
+			}
+
+			s.addNoticeMessage(fmt.Sprintf("%-28s %s", "//<message>", "send a message starting with a slash, e.g. //shrug sends /shrug"))
+
+			return nil
+		},
+	})
+
+	s.commands.register(command{
+		name:        "add",
+		usage:       "/add <username> <SellyID>",
+		description: "add a friend",
+		run: func(args string) error {
+			fields := strings.Fields(args)
+			if len(fields) != 2 {
+				return errors.New("usage: /add <username> <SellyID>")
+			}
+
+			if err := s.validateNewUsername(fields[0], ""); err != nil {
+				return err
+			}
+
+			if err := s.validateNewSellyID(fields[1], ""); err != nil {
+				return err
+			}
+
+			if err := s.addFriend(fields[0], fields[1]); err != nil {
+				return fmt.Errorf("couldn't add %s: %s", fields[0], err)
+			}
+
+			s.db.UpdateLastInteraction(fields[1])
+			s.friendsList.MoveToTop(fields[0])
+
+			s.addNoticeMessage(fmt.Sprintf("added %s to your friends", fields[0]))
+
+			return nil
+		},
+	})
+
+	s.commands.register(command{
+		name:        "delete",
+		usage:       "/delete [friend]",
+		description: "remove a friend, the selected one by default",
+		complete:    s.completeFriend,
+		run: func(args string) error {
+			username := strings.TrimSpace(args)
+			if username == "" {
+				if s.selectedFriend == nil {
+					return errors.New("usage: /delete <friend>")
+				}
+
+				username = s.selectedFriend.Username
+			}
+
+			if _, err := s.db.GetFriendDataByUsername(username); err != nil {
+				return fmt.Errorf("you don't have a friend called %s", username)
+			}
+
+			s.confirmDeleteFriend(username)
+
+			return nil
+		},
+	})
+
+	s.commands.register(command{
+		name:        "rename",
+		usage:       "/rename <friend> <new name>",
+		description: "change a friend's username",
+		complete:    s.completeFriend,
+		run: func(args string) error {
+			fields := strings.Fields(args)
+			if len(fields) != 2 {
+				return errors.New("usage: /rename <friend> <new name>")
+			}
+
+			friend, err := s.db.GetFriendDataByUsername(fields[0])
+			if err != nil {
+				return fmt.Errorf("you don't have a friend called %s", fields[0])
+			}
+
+			if err := s.validateNewUsername(fields[1], friend.Username); err != nil {
+				return err
+			}
+
+			if err := s.editFriend(friend, fields[1], friend.SellyID); err != nil {
+				return fmt.Errorf("couldn't rename %s: %s", friend.Username, err)
+			}
+
+			return nil
+		},
+	})
+
+	s.commands.register(command{
+		name:        "accept-key",
+		usage:       "/accept-key [friend]",
+		description: "accept the new security key of a friend, the selected one by default",
+		complete:    s.completeFriend,
+		run: func(args string) error {
+			username := strings.TrimSpace(args)
+			if username == "" {
+				if s.selectedFriend == nil {
+					return errors.New("usage: /accept-key <friend>")
+				}
+
+				username = s.selectedFriend.Username
+			}
+
+			friend, err := s.db.GetFriendDataByUsername(username)
+			if err != nil {
+				return fmt.Errorf("you don't have a friend called %s", username)
+			}
+
+			return s.acceptKey(friend)
+		},
+	})
+
+	s.commands.register(command{
+		name:        "search",
+		usage:       "/search [text]",
+		description: "search your messages",
+		run: func(args string) error {
+			s.showSearchScreen(strings.TrimSpace(args))
+
+			return nil
+		},
+	})
+
+	s.commands.register(command{
+		name:        "send",
+		usage:       "/send [path]",
+		description: "send a file, pick one if no path is given",
+		run: func(args string) error {
+			if args == "" {
+				s.showFilePicker()
+				return nil
+			}
+
+			return s.sendAttachment(args)
+		},
+	})
+
+	s.commands.register(command{
+		name:        "save",
+		usage:       "/save <number>",
+		description: "download a received file",
+		run: func(args string) error {
+			id, err := strconv.ParseInt(args, 10, 64)
+			if err != nil {
+				return errors.New("usage: /save <number>")
+			}
+
+			return s.saveAttachment(id)
+		},
+	})
+
+	s.commands.register(command{
+		name:        "me",
+		usage:       "/me <action>",
+		description: "describe what you're doing, e.g. /me waves",
+		run: func(args string) error {
+			if args == "" {
+				return errors.New("usage: /me <action>")
+			}
+
+			if s.conversationID() == "" {
+				return errors.New("select a friend or a group first")
+			}
+
+			s.sendText("/me " + args)
+
+			return nil
+		},
+	})
+
+	s.commands.register(command{
+		name:        "edit",
+		usage:       "/edit",
+		description: "write a message in your $EDITOR",
+		run: func(string) error {
+			s.openEditor()
+
+			return nil
+		},
+	})
+
+	s.commands.register(command{
+		name:        "raw",
+		usage:       "/raw",
+		description: "show messages as they were written or formatted again",
+		run: func(string) error {
+			s.toggleRawText()
+
+			return nil
+		},
+	})
+
+	s.commands.register(command{
+		name:        "clear",
+		usage:       "/clear",
+		description: "clear the chat window, your messages are kept",
+		run: func(string) error {
+			s.clearMessages()
+
+			return nil
+		},
+	})
+
+	s.commands.register(command{
+		name:        "export",
+		usage:       "/export",
+		description: "save your SellyID and seed to account.json",
+		run: func(string) error {
+			s.exportAccount()
+			s.addNoticeMessage("exported your account to account.json")
+
+			return nil
+		},
+	})
+}
+
+// runCommand runs a command typed into the message input, e.g. "/send ~/photo.jpg".
+func (s *Main) runCommand(input string) {
+	name, args := input, ""
+	if i := strings.IndexByte(input, ' '); i != -1 {
+		name, args = input[:i], strings.TrimSpace(input[i+1:])
+	}
+
+	c, ok := s.commands.get(name)
+	if !ok {
+		s.addErrorMessage(fmt.Sprintf("unknown command %s, type /help to see all commands or /%s to send it as a message", name, input))
+		return
+	}
+
+	// the input is cleared first, some commands open another screen
+	s.messageInput.SetText("")
+
+	if err := c.run(args); err != nil {
+		s.messageInput.SetText(input)
+		s.addErrorMessage(err.Error())
+	}
+}
+
+// completeCommand completes the last word of a command, either the command's name or one of its arguments.
+// If there are several candidates, it completes their common prefix and lists them.
+func (s *Main) completeCommand(input string) string {
+	words := strings.Split(input, " ")
+	last := words[len(words)-1]
+
+	var candidates []string
+
+	if len(words) == 1 {
+		candidates = s.commands.names()
+	} else if c, ok := s.commands.get(words[0]); ok && c.complete != nil {
+		candidates = c.complete(len(words) - 2)
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, last) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return input
+	case 1:
+		words[len(words)-1] = matches[0] + " "
+	default:
+		sort.Strings(matches)
+
+		words[len(words)-1] = commonPrefix(matches)
+		s.addNoticeMessage(strings.Join(matches, "  "))
+	}
+
+	return strings.Join(words, " ")
+}
+
+// completeFriend completes the first argument with the usernames of friends.
+func (s *Main) completeFriend(index int) []string {
+	if index != 0 {
+		return nil
+	}
+
+	friends, err := s.db.GetFriends()
+	if err != nil {
+		return nil
+	}
+
+	usernames := make([]string, len(friends))
+	for i, friend := range friends {
+		usernames[i] = friend.Username
+	}
+
+	return usernames
+}
+
+// validateNewUsername checks the username of a friend being added, or being edited if current is their
+// username so far.
+func (s *Main) validateNewUsername(username, current string) error {
+	if ok, reason := validateUsername(username); !ok {
+		return errors.New(reason)
+	}
+
+	if username == current {
+		return nil
+	}
+
+	if _, err := s.db.GetFriendDataByUsername(username); err == nil {
+		return fmt.Errorf("you already have a friend called %s", username)
+	}
+
+	return nil
+}
+
+// validateNewSellyID checks the SellyID of a friend being added, or being edited if current is their
+// SellyID so far.
+func (s *Main) validateNewSellyID(sellyID, current string) error {
+	if ok, reason := validateSellyIDText(sellyID); !ok {
+		return errors.New(reason)
+	}
+
+	if sellyID == current {
+		return nil
+	}
+
+	if sellyID == s.localUser.SellyID {
+		return errors.New("that's your own SellyID")
+	}
+
+	if friend, err := s.db.GetFriendDataBySellyID(sellyID); err == nil {
+		return fmt.Errorf("%s already has that SellyID", friend.Username)
+	}
+
+	return nil
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+
+	return prefix
+}
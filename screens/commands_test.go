@@ -0,0 +1,146 @@
+package screens
+
+import (
+	"github.com/XiovV/selly-client/composer"
+	"github.com/XiovV/selly-client/data"
+	"github.com/XiovV/selly-client/friendslist"
+	"github.com/XiovV/selly-client/ws"
+	"github.com/gdamore/tcell/v2"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	localID = strings.Repeat("a", 64)
+	bobID   = strings.Repeat("b", 64)
+	carolID = strings.Repeat("c", 64)
+)
+
+// newDBTestMain returns a disconnected screen with a database holding the friends bob and carol.
+func newDBTestMain(t *testing.T) *Main {
+	t.Helper()
+
+	s := newTestMain()
+	s.db = data.NewRepository(filepath.Join(t.TempDir(), "selly.db"))
+	s.localUser.SellyID = localID
+	s.friendsList = friendslist.New(s.theme)
+	s.messageInput = composer.New()
+	s.statusBar = newStatusBar("", s.theme)
+	s.ws = ws.NewManager("", nil)
+	s.typing = newTypingNotifier(func(string, bool) {}, func(f func()) { f() })
+
+	t.Cleanup(func() { s.db.Close() })
+
+	for _, friend := range []data.Friend{{SellyID: bobID, Username: "bob"}, {SellyID: carolID, Username: "carol"}} {
+		if err := s.addFriend(friend.Username, friend.SellyID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.registerCommands()
+
+	return s
+}
+
+func TestSendSlashMessage(t *testing.T) {
+	s := newDBTestMain(t)
+
+	bob, err := s.db.GetFriendDataBySellyID(bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.selectedFriend = &bob
+
+	for _, text := range []string{"//shrug", "//usr/bin is full"} {
+		s.messageInput.SetText(text)
+		s.sendMessage(tcell.KeyEnter)
+
+		if input := s.messageInput.GetText(); input != "" {
+			t.Errorf("%q was kept in the input as %q", text, input)
+		}
+	}
+
+	messages, err := s.db.GetOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != 2 || messages[0].Message != "/shrug" || messages[1].Message != "/usr/bin is full" {
+		t.Errorf("got %+v, want /shrug and /usr/bin is full", messages)
+	}
+}
+
+func TestRename(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  string
+		valid bool
+	}{
+		{"new name", "bob robert", true},
+		{"unchanged name", "bob bob", true},
+		{"another friend's name", "bob carol", false},
+		{"unknown friend", "dave david", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDBTestMain(t)
+
+			c, _ := s.commands.get("rename")
+			if err := c.run(tt.args); (err == nil) != tt.valid {
+				t.Errorf("got error %v, want valid %t", err, tt.valid)
+			}
+
+			if _, err := s.db.GetFriendDataBySellyID(bobID); err != nil {
+				t.Errorf("bob's SellyID was lost: %s", err)
+			}
+		})
+	}
+}
+
+func TestValidateEditedFriend(t *testing.T) {
+	s := newDBTestMain(t)
+
+	tests := []struct {
+		name              string
+		username, sellyID string
+		valid             bool
+	}{
+		{"unchanged", "bob", bobID, true},
+		{"new name and SellyID", "robert", strings.Repeat("d", 64), true},
+		{"another friend's name", "carol", bobID, false},
+		{"another friend's SellyID", "bob", carolID, false},
+		{"own SellyID", "bob", localID, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usernameErr := s.validateNewUsername(tt.username, "bob")
+			sellyIDErr := s.validateNewSellyID(tt.sellyID, bobID)
+
+			if valid := usernameErr == nil && sellyIDErr == nil; valid != tt.valid {
+				t.Errorf("got errors %v and %v, want valid %t", usernameErr, sellyIDErr, tt.valid)
+			}
+		})
+	}
+}
+
+func TestEditFriendDuplicate(t *testing.T) {
+	s := newDBTestMain(t)
+
+	bob, err := s.db.GetFriendDataBySellyID(bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the database rejects what validation would have caught, it's reported rather than crashing
+	if err := s.editFriend(bob, "bob", carolID); err == nil {
+		t.Error("gave bob carol's SellyID")
+	}
+
+	if friend, err := s.db.GetFriendDataBySellyID(bobID); err != nil || friend.Username != "bob" {
+		t.Errorf("got %+v (%v), want bob unchanged", friend, err)
+	}
+}
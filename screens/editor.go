@@ -0,0 +1,70 @@
+package screens
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// openEditor lets the user write the message in their editor, starting with what's already in the message
+// input. The message isn't sent until the user presses Enter.
+func (s *Main) openEditor() {
+	// the draft is only readable by the user and removed as soon as the editor exits
+	file, err := ioutil.TempFile("", "selly-*.txt")
+	if err != nil {
+		s.addErrorMessage(fmt.Sprintf("couldn't create a file for the editor: %s", err))
+		return
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(s.messageInput.GetText())
+	file.Close()
+	if err != nil {
+		s.addErrorMessage(fmt.Sprintf("couldn't create a file for the editor: %s", err))
+		return
+	}
+
+	s.app.Suspend(func() {
+		cmd := editorCommand(file.Name())
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+		err = cmd.Run()
+	})
+
+	if err != nil {
+		s.addErrorMessage(fmt.Sprintf("couldn't run your editor: %s", err))
+		return
+	}
+
+	content, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		s.addErrorMessage(fmt.Sprintf("couldn't read the message from the editor: %s", err))
+		return
+	}
+
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	s.messageInput.SetText(strings.TrimRight(text, "\n"))
+	s.app.SetFocus(s.messageInput)
+}
+
+// editorCommand opens path in $VISUAL or $EDITOR, either may include arguments like "code --wait".
+func editorCommand(path string) *exec.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	args := strings.Fields(editor)
+
+	return exec.Command(args[0], append(args[1:], path)...)
+}
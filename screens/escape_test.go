@@ -0,0 +1,177 @@
+package screens
+
+import (
+	"github.com/XiovV/selly-client/config"
+	"github.com/XiovV/selly-client/data"
+	"github.com/XiovV/selly-client/theme"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hostile are names and messages trying to add colors, regions or terminal escape sequences to the chat.
+var hostile = []struct {
+	name    string
+	payload string
+}{
+	{"color tag", "[red]red[-]"},
+	{"background tag", "[:red]background"},
+	{"attribute tag", "[::bl]blinking"},
+	{"hex color tag", "[#ff0000]hex"},
+	{"region tag", `["evil"]region[""]`},
+	{"region with a link's ID", `["link-0"]not a link`},
+	{"escaped tag", "[red[]escaped"},
+	{"lone bracket", "["},
+	{"open brackets", "[[[[["},
+	{"unclosed tag", "[red"},
+	{"brackets in text", "a[b]c[d"},
+	{"ANSI color", "\x1b[31mred\x1b[0m"},
+	{"ANSI clear screen", "\x1b[2J\x1b[H"},
+	{"8-bit CSI", "\u009b31mred"},
+	{"control characters", "bell\a carriage\r back\b"},
+	{"long name", strings.Repeat("[red]A", 2000)},
+}
+
+func newTestMain() *Main {
+	th, _ := theme.Load(theme.Dark, "")
+
+	s := &Main{
+		internalTextView: tview.NewTextView(),
+		cfg:              config.Default(),
+		theme:            th,
+		localUser:        &data.LocalUser{SellyID: "local"},
+		links:            newLinkRegions(),
+	}
+
+	s.internalTextView.SetDynamicColors(true).SetRegions(true)
+
+	return s
+}
+
+// assertShownLiterally checks that text shows payload as it is, i.e. none of it was taken for a tag.
+func assertShownLiterally(t *testing.T, text, payload string) {
+	t.Helper()
+
+	view := tview.NewTextView().SetDynamicColors(true).SetRegions(true)
+	view.SetText(text)
+
+	if shown := view.GetText(true); !strings.Contains(shown, payload) {
+		t.Errorf("%q isn't shown as it is, got %q", payload, shown)
+	}
+}
+
+// draw draws p on a simulated terminal and returns its cells.
+func draw(t *testing.T, p tview.Primitive) ([]tcell.SimCell, int) {
+	t.Helper()
+
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+
+	screen.SetSize(200, 50)
+	p.SetRect(0, 0, 200, 50)
+	p.Draw(screen)
+	screen.Show()
+
+	cells, width, _ := screen.GetContents()
+
+	return cells, width
+}
+
+// assertNoControlCharacters draws p and checks that no control character reaches the terminal.
+func assertNoControlCharacters(t *testing.T, p tview.Primitive) {
+	t.Helper()
+
+	cells, _ := draw(t, p)
+	for _, cell := range cells {
+		for _, r := range cell.Runes {
+			if r < ' ' || r >= 0x7f && r < 0xa0 {
+				t.Fatalf("control character %U reached the screen", r)
+			}
+		}
+	}
+}
+
+func TestAddMessageHostile(t *testing.T) {
+	for _, tt := range hostile {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, rawText := range []bool{false, true} {
+				s := newTestMain()
+				s.rawText = rawText
+
+				s.addMessage(data.Message{RowID: 1, Sender: "friend", Message: tt.payload, DateCrated: time.Now().Unix()}, tt.payload)
+
+				// the sender's name is followed by the message
+				text := s.internalTextView.GetText(false)
+				assertShownLiterally(t, text, tt.payload+": "+tt.payload)
+
+				assertNoControlCharacters(t, s.internalTextView)
+			}
+		})
+	}
+}
+
+func TestFormatMessageHostile(t *testing.T) {
+	for _, tt := range hostile {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestMain()
+
+			assertShownLiterally(t, s.formatMessage(tt.payload, "msg-1"), tt.payload)
+		})
+	}
+}
+
+func TestNoticesHostile(t *testing.T) {
+	for _, tt := range hostile {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestMain()
+
+			s.addNoticeMessage(tt.payload)
+			s.addErrorMessage(tt.payload)
+
+			assertShownLiterally(t, s.internalTextView.GetText(false), tt.payload)
+			assertNoControlCharacters(t, s.internalTextView)
+		})
+	}
+}
+
+func TestFilePickerHostile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selly-picker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	names := []string{"[red]file", `["evil"]file`, "file[", "[[dir"}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	picker := NewFilePicker(dir, tcell.ColorBlue, func(string) {}, func() {})
+
+	cells, width := draw(t, picker.treeView)
+
+	var shown strings.Builder
+	for i, cell := range cells {
+		if i%width == 0 {
+			shown.WriteString("\n")
+		}
+
+		shown.WriteString(string(cell.Runes))
+	}
+
+	for _, name := range names {
+		if !strings.Contains(shown.String(), name+" ") {
+			t.Errorf("%q isn't shown as it is, got %q", name, shown.String())
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package screens
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// FilePicker lets the user browse directories and pick a file. Directories are listed when they're
+// expanded for the first time, hidden files are left out. Directories are shown in dirColor.
+type FilePicker struct {
+	treeView *tview.TreeView
+	dirColor tcell.Color
+	onSelect func(path string)
+}
+
+// fileNode is the reference of every node in the picker.
+type fileNode struct {
+	path  string
+	isDir bool
+}
+
+func NewFilePicker(root string, dirColor tcell.Color, onSelect func(path string), onCancel func()) *FilePicker {
+	p := &FilePicker{treeView: tview.NewTreeView(), dirColor: dirColor, onSelect: onSelect}
+
+	// file names may contain anything, e.g. "[red]", so they're escaped before they're shown
+	rootNode := tview.NewTreeNode(tview.Escape(root)).SetReference(fileNode{root, true}).SetColor(dirColor)
+	p.addChildren(rootNode, root)
+
+	p.treeView.SetRoot(rootNode).SetCurrentNode(rootNode)
+	p.treeView.SetSelectedFunc(p.onNodeSelect)
+	p.treeView.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			onCancel()
+		}
+	})
+
+	p.treeView.SetBorder(true).SetTitle("Pick a file to send (Esc to cancel)").SetTitleAlign(tview.AlignLeft)
+
+	return p
+}
+
+func (p *FilePicker) onNodeSelect(node *tview.TreeNode) {
+	file := node.GetReference().(fileNode)
+
+	if !file.isDir {
+		p.onSelect(file.path)
+		return
+	}
+
+	if len(node.GetChildren()) == 0 {
+		p.addChildren(node, file.path)
+		node.SetExpanded(true)
+		return
+	}
+
+	node.SetExpanded(!node.IsExpanded())
+}
+
+func (p *FilePicker) addChildren(node *tview.TreeNode, dir string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		child := tview.NewTreeNode(tview.Escape(file.Name())).SetReference(fileNode{filepath.Join(dir, file.Name()), file.IsDir()})
+		if file.IsDir() {
+			child.SetText(tview.Escape(file.Name() + string(filepath.Separator))).SetColor(p.dirColor)
+		}
+
+		node.AddChild(child)
+	}
+}
+
+func (p *FilePicker) Render() tview.Primitive {
+	return p.treeView
+}
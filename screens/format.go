@@ -0,0 +1,167 @@
+package screens
+
+import (
+	"fmt"
+	"github.com/XiovV/selly-client/markup"
+	"github.com/XiovV/selly-client/theme"
+	"github.com/rivo/tview"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// linkRegions gives every URL shown in the chat a region of its own, so it can be opened by clicking it.
+// A URL keeps its region when the chat is rendered again.
+type linkRegions struct {
+	urls    []string
+	regions map[string]string
+}
+
+func newLinkRegions() *linkRegions {
+	return &linkRegions{regions: map[string]string{}}
+}
+
+func (l *linkRegions) region(url string) string {
+	if region, ok := l.regions[url]; ok {
+		return region
+	}
+
+	region := "link-" + strconv.Itoa(len(l.urls))
+	l.urls = append(l.urls, url)
+	l.regions[url] = region
+
+	return region
+}
+
+func (l *linkRegions) url(region string) (string, bool) {
+	i, err := strconv.Atoi(strings.TrimPrefix(region, "link-"))
+	if err != nil || !strings.HasPrefix(region, "link-") || i >= len(l.urls) {
+		return "", false
+	}
+
+	return l.urls[i], true
+}
+
+// formatMessage returns the text of a message the way it's written into the chat, escaped and with its
+// formatting turned into color tags. Links get regions of their own, so the message's region is opened
+// again after each of them.
+func (s *Main) formatMessage(text, region string) string {
+	if s.rawText {
+		return tview.Escape(text)
+	}
+
+	var b strings.Builder
+
+	for i, line := range markup.Parse(text) {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		switch {
+		case line.Quote:
+			b.WriteString(s.theme.Muted.Tag() + "│ ")
+		case line.CodeBlock:
+			// code blocks start on a line of their own, below the sender's name
+			if i == 0 {
+				b.WriteString("\n")
+			}
+
+			b.WriteString("  ")
+		}
+
+		for _, span := range line.Spans {
+			b.WriteString(s.spanStyle(span.Format, line.Quote).Tag())
+
+			if span.Format&markup.Link == 0 {
+				b.WriteString(tview.Escape(span.Text))
+				continue
+			}
+
+			fmt.Fprintf(&b, `["%s"]%s[""]`, s.links.region(span.Text), tview.Escape(span.Text))
+			if region != "" {
+				fmt.Fprintf(&b, `["%s"]`, region)
+			}
+		}
+	}
+
+	b.WriteString(s.theme.Text.Tag())
+
+	return b.String()
+}
+
+func (s *Main) spanStyle(format markup.Format, quote bool) theme.Style {
+	style := s.theme.Text
+	if quote {
+		style = s.theme.Muted
+	}
+
+	switch {
+	case format&markup.Code != 0:
+		style = s.theme.Code
+	case format&markup.Link != 0:
+		style = s.theme.Accent.With("u")
+	}
+
+	if format&markup.Bold != 0 {
+		style = style.With("b")
+	}
+
+	if format&markup.Italic != 0 {
+		style = style.With("i")
+	}
+
+	return style
+}
+
+// toggleRawText switches between showing messages formatted and exactly as they were written.
+func (s *Main) toggleRawText() {
+	s.rawText = !s.rawText
+	s.reloadMessages()
+
+	if s.rawText {
+		s.addNoticeMessage("showing messages as they were written")
+	} else {
+		s.addNoticeMessage("showing formatted messages")
+	}
+}
+
+// onChatHighlight opens links when they're clicked, which highlights their region.
+func (s *Main) onChatHighlight(added, removed, remaining []string) {
+	for _, region := range added {
+		url, ok := s.links.url(region)
+		if !ok {
+			continue
+		}
+
+		s.internalTextView.Highlight()
+
+		if err := openURL(url); err != nil {
+			s.addErrorMessage(fmt.Sprintf("couldn't open %s: %s", url, err))
+		}
+
+		return
+	}
+}
+
+// openURL opens url in the default browser.
+func openURL(url string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	go cmd.Wait()
+
+	return nil
+}
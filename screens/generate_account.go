@@ -1,36 +1,41 @@
 package screens
 
 import (
-	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"github.com/XiovV/selly-client/config"
 	"github.com/XiovV/selly-client/data"
+	"github.com/XiovV/selly-client/seed"
 	"github.com/rivo/tview"
 	"io/ioutil"
-	"math/rand"
-	"strings"
-	"time"
+	"log"
 )
 
 type GenerateAccount struct {
-	app       *tview.Application
-	pages     *tview.Pages
-	seedWords []string
-	db        *data.Repository
+	app            *tview.Application
+	pages          *tview.Pages
+	db             *data.Repository
+	cfg            *config.Config
+	onAccountReady func()
 }
 
-func NewGenerateAccountScreen(app *tview.Application, db *data.Repository) *GenerateAccount {
+func NewGenerateAccountScreen(app *tview.Application, db *data.Repository, cfg *config.Config, onAccountReady func()) *GenerateAccount {
 	return &GenerateAccount{
-		app:       app,
-		pages:     tview.NewPages(),
-		seedWords: []string{"apple", "banana", "car", "orange", "book", "monitor", "computer", "poster", "box", "fan", "card", "desk", "table"},
-		db:        db,
+		app:            app,
+		pages:          tview.NewPages(),
+		db:             db,
+		cfg:            cfg,
+		onAccountReady: onAccountReady,
 	}
 }
 
 func (s *GenerateAccount) Render() tview.Primitive {
-	id, seed := s.generateNewID()
-	seedStr := strings.Join(seed, ", ")
+	id, words, err := s.generateNewID()
+	if err != nil {
+		log.Fatalf("couldn't generate seed: %s", err)
+	}
+
+	seedStr := seed.String(words)
 
 	return s.pages.AddPage("main-modal", tview.NewModal().
 		SetText(fmt.Sprintf("Your new ID is: %s\n\n Your seed is: %s\n\nWrite this seed down or export it so you can restore your account later!", id, seedStr)).
@@ -39,11 +44,11 @@ func (s *GenerateAccount) Render() tview.Primitive {
 			switch buttonLabel {
 			case "Next":
 				s.persistID(id, seedStr)
-				s.app.SetRoot(NewMainScreen(s.app, s.db).Render(), true)
+				s.onAccountReady()
 			case "Export":
 				s.persistID(id, seedStr)
-				s.exportAccount(id, strings.Join(seed, ", "))
-				s.app.SetRoot(NewMainScreen(s.app, s.db).Render(), true)
+				s.exportAccount(id, seedStr)
+				s.onAccountReady()
 			}
 		}), false, true)
 }
@@ -61,29 +66,13 @@ func (s *GenerateAccount) exportAccount(id, seed string) {
 	ioutil.WriteFile("account.json", file, 0644)
 }
 
-func (s *GenerateAccount) generateNewID() (string, []string) {
-	rand.Seed(time.Now().UnixNano())
-
-	seed := []string{}
-
-	for i := 0; i < 5; i++ {
-		randomIndex := rand.Intn(len(s.seedWords) - 1 + 1)
-		seed = append(seed, s.seedWords[randomIndex])
+func (s *GenerateAccount) generateNewID() (string, []string, error) {
+	words, err := seed.Generate(s.cfg.SeedWords)
+	if err != nil {
+		return "", nil, err
 	}
 
-	hashedSeed := sha256.Sum256([]byte(strings.Join(seed, "")))
-
-	sellyId := sha256.Sum256([]byte(fmt.Sprintf("%x", hashedSeed[:])))
-
-	return fmt.Sprintf("%x", sellyId[:]), seed
-}
-
-func (s *GenerateAccount) generateIDFromSeed(seed []string) string {
-	hashedSeed := sha256.Sum256([]byte(strings.Join(seed, "")))
-
-	sellyId := sha256.Sum256([]byte(fmt.Sprintf("%x", hashedSeed[:])))
-
-	return fmt.Sprintf("%x", sellyId[:])
+	return seed.SellyID(words), words, nil
 }
 
 func (s *GenerateAccount) persistID(id, seed string) error {
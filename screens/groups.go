@@ -0,0 +1,450 @@
+package screens
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/XiovV/selly-client/data"
+	"github.com/XiovV/selly-client/protocol"
+	"github.com/rivo/tview"
+	"log"
+	"strings"
+)
+
+var errNotConnected = errors.New("you need to be connected to the server to manage groups")
+
+func (s *Main) showGroupsScreen() {
+	buttons := []string{"New Group", "Back"}
+	if s.selectedGroup != nil && s.selectedGroup.Creator == s.localUser.SellyID {
+		buttons = []string{"New Group", "Invite Friends", "Leave Group", "Back"}
+	} else if s.selectedGroup != nil {
+		buttons = []string{"New Group", "Leave Group", "Back"}
+	}
+
+	modal := tview.NewModal().
+		SetText("Groups let you chat with several friends at once. Messages are encrypted for every member separately.").
+		AddButtons(buttons)
+
+	modal.SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+		if buttonLabel == "Back" {
+			s.app.SetRoot(s.Render(), true)
+			return
+		}
+
+		if !s.ws.IsConnected() {
+			modal.SetText(errNotConnected.Error())
+			return
+		}
+
+		switch buttonLabel {
+		case "New Group":
+			s.showNewGroupScreen()
+		case "Invite Friends":
+			s.showInviteScreen()
+		case "Leave Group":
+			s.showLeaveGroupScreen()
+		}
+	})
+
+	s.app.SetRoot(modal, true)
+}
+
+func (s *Main) showNewGroupScreen() {
+	friends, err := s.db.GetFriendsSorted()
+	if err != nil {
+		log.Fatalf("couldn't fetch friends: %s", err)
+	}
+
+	form := tview.NewForm().AddInputField("Name", "", 0, nil, nil)
+	nameField := form.GetFormItem(0).(*tview.InputField)
+
+	checkboxes := s.addFriendCheckboxes(form, friends)
+
+	errorView := tview.NewTextView()
+	errorView.SetTextColor(s.theme.Error.Color())
+
+	form.AddButton("Create", func() {
+		name := strings.TrimSpace(nameField.GetText())
+		if name == "" || len(name) > 64 {
+			errorView.SetText("the name must be between 1 and 64 characters long")
+			return
+		}
+
+		members := checkedFriends(friends, checkboxes)
+		if len(members) == 0 {
+			errorView.SetText("select at least one friend")
+			return
+		}
+
+		if err := s.createGroup(name, members); err != nil {
+			errorView.SetText(err.Error())
+			return
+		}
+
+		s.app.SetRoot(s.Render(), true)
+	})
+
+	form.AddButton("Cancel", func() {
+		s.app.SetRoot(s.Render(), true)
+	})
+
+	form.SetBorder(true).SetTitle("New Group").SetTitleAlign(tview.AlignLeft)
+	s.app.SetRoot(tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(form, 0, 1, true).
+		AddItem(errorView, 2, 0, false), true)
+}
+
+func (s *Main) showInviteScreen() {
+	friends, err := s.db.GetFriendsSorted()
+	if err != nil {
+		log.Fatalf("couldn't fetch friends: %s", err)
+	}
+
+	// only friends who aren't members yet can be invited
+	var candidates []data.Friend
+	for _, friend := range friends {
+		if !s.db.IsGroupMember(s.selectedGroup.GroupID, friend.SellyID) {
+			candidates = append(candidates, friend)
+		}
+	}
+
+	form := tview.NewForm()
+	checkboxes := s.addFriendCheckboxes(form, candidates)
+
+	errorView := tview.NewTextView()
+	errorView.SetTextColor(s.theme.Error.Color())
+
+	if len(candidates) == 0 {
+		errorView.SetText("all of your friends are already members of this group")
+	}
+
+	form.AddButton("Invite", func() {
+		invited := checkedFriends(candidates, checkboxes)
+		if len(invited) == 0 {
+			errorView.SetText("select at least one friend")
+			return
+		}
+
+		if err := s.inviteToGroup(*s.selectedGroup, invited); err != nil {
+			errorView.SetText(err.Error())
+			return
+		}
+
+		s.updateChatTitle()
+		s.app.SetRoot(s.Render(), true)
+	})
+
+	form.AddButton("Cancel", func() {
+		s.app.SetRoot(s.Render(), true)
+	})
+
+	form.SetBorder(true).SetTitle(fmt.Sprintf("Invite to %s", tview.Escape(s.selectedGroup.Name))).SetTitleAlign(tview.AlignLeft)
+	s.app.SetRoot(tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(form, 0, 1, true).
+		AddItem(errorView, 2, 0, false), true)
+}
+
+func (s *Main) showLeaveGroupScreen() {
+	modal := tview.NewModal().
+		SetText(fmt.Sprintf("Are you sure that you would like to leave %s? Its messages will be deleted.", tview.Escape(s.selectedGroup.Name))).
+		AddButtons([]string{"Yes", "No"})
+
+	modal.SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+		if buttonLabel == "Yes" {
+			if err := s.leaveGroup(*s.selectedGroup); err != nil {
+				modal.SetText(err.Error())
+				return
+			}
+
+			s.selectedGroup = nil
+			s.internalTextView.SetText("").SetTitle("")
+
+			s.loadFirstFriend()
+		}
+
+		s.app.SetRoot(s.Render(), true)
+	})
+
+	s.app.SetRoot(modal, true)
+}
+
+// addFriendCheckboxes adds a checkbox for every friend to the form, in the same order as friends.
+func (s *Main) addFriendCheckboxes(form *tview.Form, friends []data.Friend) []*tview.Checkbox {
+	checkboxes := make([]*tview.Checkbox, len(friends))
+
+	for i, friend := range friends {
+		checkboxes[i] = tview.NewCheckbox().SetLabel(tview.Escape(friend.Username))
+		form.AddFormItem(checkboxes[i])
+	}
+
+	return checkboxes
+}
+
+func checkedFriends(friends []data.Friend, checkboxes []*tview.Checkbox) []data.Friend {
+	var checked []data.Friend
+
+	for i, checkbox := range checkboxes {
+		if checkbox.IsChecked() {
+			checked = append(checked, friends[i])
+		}
+	}
+
+	return checked
+}
+
+func (s *Main) createGroup(name string, friends []data.Friend) error {
+	group := data.Group{GroupID: data.NewGroupID(), Name: name, Creator: s.localUser.SellyID}
+
+	members := []data.GroupMember{{GroupID: group.GroupID, SellyID: s.localUser.SellyID, PublicKey: s.localUser.PublicKey}}
+	for _, friend := range friends {
+		members = append(members, data.GroupMember{GroupID: group.GroupID, SellyID: friend.SellyID, PublicKey: friend.PublicKey})
+	}
+
+	if err := s.db.SaveGroup(group, members); err != nil {
+		return err
+	}
+
+	s.friendsList.AddGroup(group.Name, group.GroupID)
+	s.friendsList.MoveGroupToTop(group.GroupID)
+
+	return s.sendGroupInvite(group)
+}
+
+func (s *Main) inviteToGroup(group data.Group, friends []data.Friend) error {
+	members, err := s.db.GetGroupMembers(group.GroupID)
+	if err != nil {
+		return err
+	}
+
+	for _, friend := range friends {
+		members = append(members, data.GroupMember{GroupID: group.GroupID, SellyID: friend.SellyID, PublicKey: friend.PublicKey})
+	}
+
+	if err := s.db.SaveGroup(group, members); err != nil {
+		return err
+	}
+
+	return s.sendGroupInvite(group)
+}
+
+func (s *Main) leaveGroup(group data.Group) error {
+	if !s.ws.IsConnected() {
+		return errNotConnected
+	}
+
+	members, err := s.db.GetGroupMembers(group.GroupID)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if member.SellyID == s.localUser.SellyID {
+			continue
+		}
+
+		err := s.send(protocol.TypeGroup, protocol.Group{
+			Sender:   s.localUser.SellyID,
+			Receiver: member.SellyID,
+			Action:   protocol.GroupLeave,
+			GroupID:  group.GroupID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.db.DeleteGroup(group.GroupID); err != nil {
+		return err
+	}
+
+	s.friendsList.RemoveGroup(group.GroupID)
+
+	return nil
+}
+
+// sendGroupInvite sends the group's name and members to every member, so new members learn about the
+// group and existing ones about its new members.
+func (s *Main) sendGroupInvite(group data.Group) error {
+	if !s.ws.IsConnected() {
+		return errNotConnected
+	}
+
+	members, err := s.db.GetGroupMembers(group.GroupID)
+	if err != nil {
+		return err
+	}
+
+	wireMembers := make([]protocol.GroupMember, len(members))
+	for i, member := range members {
+		wireMembers[i] = protocol.GroupMember{SellyID: member.SellyID, PublicKey: s.publicKeyOf(member.SellyID, group.GroupID)}
+	}
+
+	for _, member := range members {
+		if member.SellyID == s.localUser.SellyID {
+			continue
+		}
+
+		err := s.send(protocol.TypeGroup, protocol.Group{
+			Sender:   s.localUser.SellyID,
+			Receiver: member.SellyID,
+			Action:   protocol.GroupInvite,
+			GroupID:  group.GroupID,
+			Name:     group.Name,
+			Members:  wireMembers,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Main) readGroup(envelope protocol.Envelope) error {
+	var update protocol.Group
+
+	if err := envelope.DecodeMsg(&update); err != nil {
+		return err
+	}
+
+	switch update.Action {
+	case protocol.GroupInvite:
+		return s.readGroupInvite(update)
+	case protocol.GroupLeave:
+		return s.readGroupLeave(update)
+	}
+
+	return fmt.Errorf("unknown group action %q", update.Action)
+}
+
+func (s *Main) readGroupInvite(update protocol.Group) error {
+	// the ID of a group mustn't be mistaken for the ID of a friend or our own
+	if !data.IsGroupID(update.GroupID) || update.GroupID == s.localUser.SellyID || s.isFriend(update.GroupID) {
+		return fmt.Errorf("group invite with an invalid group ID %q", update.GroupID)
+	}
+
+	group, err := s.db.GetGroup(update.GroupID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	isNew := err != nil
+
+	// anyone may invite us to a new group, which makes them its creator, and only the creator may change it
+	if isNew {
+		group = data.Group{GroupID: update.GroupID, Creator: update.Sender}
+	} else if group.Creator == "" || group.Creator != update.Sender {
+		return errors.New("group invite from someone other than the group's creator")
+	}
+
+	members := make([]data.GroupMember, 0, len(update.Members))
+	isMember := false
+
+	for _, member := range update.Members {
+		switch {
+		case member.SellyID == s.localUser.SellyID:
+			isMember = true
+			member.PublicKey = s.localUser.PublicKey
+		case s.isFriend(member.SellyID):
+			// the keys of friends are only ever taken from their own key exchange
+			member.PublicKey = ""
+		}
+
+		members = append(members, data.GroupMember{GroupID: update.GroupID, SellyID: member.SellyID, PublicKey: member.PublicKey})
+	}
+
+	if !isMember {
+		return errors.New("group invite doesn't include us")
+	}
+
+	group.Name = update.Name
+
+	if err := s.db.SaveGroup(group, members); err != nil {
+		return err
+	}
+
+	if isNew {
+		s.friendsList.AddGroup(group.Name, group.GroupID)
+		s.friendsList.MoveGroupToTop(group.GroupID)
+	} else {
+		s.friendsList.RenameGroup(group.GroupID, group.Name)
+	}
+
+	if s.selectedGroup != nil && s.selectedGroup.GroupID == group.GroupID {
+		s.selectedGroup.Name = group.Name
+		s.updateChatTitle()
+	}
+
+	return nil
+}
+
+func (s *Main) readGroupLeave(update protocol.Group) error {
+	if !s.db.IsGroupMember(update.GroupID, update.Sender) {
+		return nil
+	}
+
+	if err := s.db.RemoveGroupMember(update.GroupID, update.Sender); err != nil {
+		log.Fatalf("couldn't remove group member: %s", err)
+	}
+
+	if s.selectedGroup != nil && s.selectedGroup.GroupID == update.GroupID {
+		s.addNoticeMessage(fmt.Sprintf("%s left the group", s.senderName(update.Sender)))
+		s.updateChatTitle()
+	}
+
+	return nil
+}
+
+// sendGroupMessage sends a message to every member of the group whose key is known, each copy encrypted
+// for its receiver. msg.Receiver is the ID of the group. The members who were skipped are reported, the
+// message isn't held back for them as some of them may never be reachable.
+func (s *Main) sendGroupMessage(msg protocol.Message) error {
+	groupId := msg.Receiver
+
+	members, err := s.db.GetGroupMembers(groupId)
+	if err != nil {
+		return err
+	}
+
+	var skipped []string
+
+	for _, member := range members {
+		if member.SellyID == s.localUser.SellyID {
+			continue
+		}
+
+		publicKey := s.sendingKeyOf(member.SellyID, groupId)
+		if publicKey == "" {
+			skipped = append(skipped, s.senderName(member.SellyID))
+			continue
+		}
+
+		sealed, err := s.sealMessage(msg, publicKey)
+		if err != nil {
+			skipped = append(skipped, s.senderName(member.SellyID))
+			continue
+		}
+
+		sealed.Receiver = member.SellyID
+		sealed.GroupID = groupId
+
+		if err := s.send(protocol.TypeMessage, sealed); err != nil {
+			return err
+		}
+	}
+
+	if len(skipped) > 0 {
+		group, _ := s.db.GetGroup(groupId)
+		s.addErrorMessage(fmt.Sprintf("your message to %s wasn't sent to %s, their security key isn't known or hasn't been accepted", group.Name, strings.Join(skipped, ", ")))
+	}
+
+	return nil
+}
+
+func (s *Main) addGroupToList(group data.Group) {
+	s.friendsList.AddGroup(group.Name, group.GroupID)
+
+	unreadMessagesCount := s.db.GetCountOfUnreadMessages(group.GroupID)
+
+	s.friendsList.SetGroupUnreadCounter(group.GroupID, unreadMessagesCount)
+}
@@ -0,0 +1,47 @@
+package screens
+
+import (
+	"github.com/XiovV/selly-client/data"
+	"github.com/XiovV/selly-client/protocol"
+	"strings"
+	"testing"
+)
+
+func TestReadGroupInviteID(t *testing.T) {
+	mallory := strings.Repeat("e", 64)
+
+	tests := []struct {
+		name    string
+		groupId string
+		valid   bool
+	}{
+		{"new group", data.NewGroupID(), true},
+		{"a friend's SellyID", bobID, false},
+		{"our own SellyID", localID, false},
+		{"empty", "", false},
+		{"not hex", strings.Repeat("g", 32), false},
+		{"upper case", strings.ToUpper(strings.Repeat("ab", 16)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDBTestMain(t)
+
+			err := s.readGroupInvite(protocol.Group{
+				Sender:   mallory,
+				Receiver: s.localUser.SellyID,
+				Action:   protocol.GroupInvite,
+				GroupID:  tt.groupId,
+				Name:     "group",
+				Members:  []protocol.GroupMember{{SellyID: s.localUser.SellyID}, {SellyID: mallory, PublicKey: "mallory's key"}},
+			})
+			if valid := err == nil; valid != tt.valid {
+				t.Fatalf("got error %v, want valid %t", err, tt.valid)
+			}
+
+			if _, err := s.db.GetGroup(tt.groupId); (err == nil) != tt.valid {
+				t.Errorf("got %v looking up the group, want it stored %t", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package screens
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"sync"
+	"time"
+)
+
+// idleWatcher keeps track of when the user last pressed a key or used the mouse.
+type idleWatcher struct {
+	mu           sync.Mutex
+	lastActivity time.Time
+}
+
+func newIdleWatcher(app *tview.Application) *idleWatcher {
+	w := &idleWatcher{lastActivity: time.Now()}
+
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		w.touch()
+		return event
+	})
+
+	app.SetMouseCapture(func(event *tcell.EventMouse, action tview.MouseAction) (*tcell.EventMouse, tview.MouseAction) {
+		if action != tview.MouseMove {
+			w.touch()
+		}
+
+		return event, action
+	})
+
+	return w
+}
+
+func (w *idleWatcher) touch() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastActivity = time.Now()
+}
+
+func (w *idleWatcher) idleFor() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return time.Since(w.lastActivity)
+}
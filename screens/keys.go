@@ -0,0 +1,118 @@
+package screens
+
+import (
+	"fmt"
+	"github.com/XiovV/selly-client/keymap"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"strings"
+)
+
+// onKey runs the action bound to a key pressed on the main screen.
+func (s *Main) onKey(event *tcell.EventKey) *tcell.EventKey {
+	// Tab completes commands in the message input
+	if event.Key() == tcell.KeyTab && s.messageInput.HasFocus() && strings.HasPrefix(s.messageInput.GetText(), "/") {
+		return event
+	}
+
+	action, ok := s.keys.Action(event)
+	if !ok {
+		return event
+	}
+
+	switch action {
+	case keymap.FocusNext:
+		s.cycleFocus(1)
+	case keymap.FocusPrevious:
+		s.cycleFocus(-1)
+	case keymap.NextChat:
+		s.switchConversation(1)
+	case keymap.PreviousChat:
+		s.switchConversation(-1)
+	case keymap.AddFriend:
+		s.showAddFriendScreen()
+	case keymap.EditFriend:
+		s.showEditFriendScreen()
+	case keymap.DeleteFriend:
+		s.showDeleteFriendScreen()
+	case keymap.Groups:
+		s.showGroupsScreen()
+	case keymap.AttachFile:
+		s.showFilePicker()
+	case keymap.Search:
+		s.showSearchScreen("")
+	case keymap.MyDetails:
+		s.showMyDetailsScreen()
+	case keymap.RawText:
+		s.toggleRawText()
+	case keymap.OpenEditor:
+		s.openEditor()
+	case keymap.Help:
+		s.showKeysScreen()
+	}
+
+	return nil
+}
+
+// cycleFocus moves the focus between the friends list, the chat and the message input.
+func (s *Main) cycleFocus(step int) {
+	focusables := []tview.Primitive{s.friendsList.GetTreeView(), s.internalTextView, s.messageInput}
+
+	next := len(focusables) - 1
+	for i, p := range focusables {
+		if p.HasFocus() {
+			next = (i + step + len(focusables)) % len(focusables)
+			break
+		}
+	}
+
+	s.app.SetFocus(focusables[next])
+}
+
+// switchConversation opens the chat offset places below the selected one in the list.
+func (s *Main) switchConversation(offset int) {
+	var current *tview.TreeNode
+	if id := s.conversationID(); id != "" {
+		current = s.friendsList.FindConversation(id)
+	}
+
+	node := s.friendsList.Sibling(current, offset)
+	if node == nil {
+		return
+	}
+
+	s.friendsList.SetCurrentFriend(node)
+	s.onFriendSelect(node)
+}
+
+func (s *Main) showKeysScreen() {
+	var text strings.Builder
+
+	for _, binding := range s.keys.Bindings() {
+		key := binding.Key
+		if key == "" {
+			key = "-"
+		}
+
+		fmt.Fprintf(&text, "%s%-12s%s %s\n", s.theme.Highlight.Tag(), tview.Escape(key), s.theme.Text.Tag(), binding.Description)
+	}
+
+	text.WriteString("\n" + s.theme.Muted.Tag() + "Keys can be changed in the config file, type /help in the message box to see all commands.")
+
+	view := tview.NewTextView().SetDynamicColors(true).SetWordWrap(true).SetText(text.String())
+	view.SetBorder(true).SetTitle("Keyboard shortcuts (Esc to close)").SetTitleAlign(tview.AlignLeft)
+
+	view.SetDoneFunc(func(key tcell.Key) {
+		s.app.SetRoot(s.Render(), true)
+	})
+
+	width, height := 70, len(s.keys.Bindings())+5
+
+	s.app.SetRoot(tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(view, height, 0, true).
+			AddItem(nil, 0, 1, false), width, 0, true).
+		AddItem(nil, 0, 1, false), true)
+}
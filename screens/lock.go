@@ -0,0 +1,59 @@
+package screens
+
+import (
+	"errors"
+	"github.com/XiovV/selly-client/data"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+type Lock struct {
+	app      *tview.Application
+	db       *data.Repository
+	onUnlock func()
+}
+
+// NewLockScreen creates a screen asking for the database passphrase, onUnlock is called once it's correct.
+func NewLockScreen(app *tview.Application, db *data.Repository, onUnlock func()) *Lock {
+	return &Lock{app: app, db: db, onUnlock: onUnlock}
+}
+
+func (s *Lock) Render() tview.Primitive {
+	form := tview.NewForm().
+		AddPasswordField("Passphrase", "", 0, '*', nil)
+
+	passphraseInput := form.GetFormItem(0).(*tview.InputField)
+
+	unlock := func() {
+		err := s.db.Unlock(passphraseInput.GetText())
+		passphraseInput.SetText("")
+
+		if errors.Is(err, data.ErrWrongPassphrase) {
+			passphraseInput.SetPlaceholder("wrong passphrase")
+			return
+		}
+
+		if err != nil {
+			passphraseInput.SetPlaceholder(err.Error())
+			return
+		}
+
+		s.onUnlock()
+	}
+
+	passphraseInput.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			unlock()
+		}
+	})
+
+	form.AddButton("Unlock", unlock)
+
+	form.AddButton("Quit", func() {
+		s.app.Stop()
+	})
+
+	form.SetBorder(true).SetTitle("Selly is locked").SetTitleAlign(tview.AlignLeft)
+
+	return form
+}
@@ -2,57 +2,105 @@ package screens
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/XiovV/selly-client/attachment"
+	"github.com/XiovV/selly-client/composer"
+	"github.com/XiovV/selly-client/config"
 	"github.com/XiovV/selly-client/data"
+	"github.com/XiovV/selly-client/e2e"
 	"github.com/XiovV/selly-client/friendslist"
 	"github.com/XiovV/selly-client/jwt"
+	"github.com/XiovV/selly-client/keymap"
+	"github.com/XiovV/selly-client/protocol"
+	"github.com/XiovV/selly-client/theme"
 	"github.com/XiovV/selly-client/ws"
 	"github.com/gdamore/tcell/v2"
-	"github.com/gorilla/websocket"
+	"github.com/mattn/go-runewidth"
 	"github.com/rivo/tview"
 	"golang.design/x/clipboard"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
-const (
-	messageType = "message"
+var (
+	errUnknownKey = errors.New("public key of the receiver isn't known yet")
+	errPaused     = errors.New("the client is locked")
 )
 
+// messagesPageSize is how many messages are loaded at once, older ones are loaded as the user scrolls up.
+const messagesPageSize = 100
+
 type Main struct {
-	app               *tview.Application
-	internalTextView  *tview.TextView
-	messageInput      *tview.InputField
-	commandBox        *tview.InputField
-	friendsList       *friendslist.List
-	ws                *websocket.Conn
-	db                *data.Repository
-	localUser         *data.LocalUser
-	selectedFriend    *data.Friend
-	addFriendBtn      *tview.Button
-	deleteFriendBtn   *tview.Button
-	editFriendBtn     *tview.Button
-	myDetailsButton   *tview.Button
-	isConnectionAlive bool
-}
-
-func NewMainScreen(app *tview.Application, db *data.Repository) *Main {
+	app              *tview.Application
+	internalTextView *tview.TextView
+	messageInput     *composer.Composer
+	chatColumn       *tview.Flex
+	layout           *tview.Flex
+	friendsList      *friendslist.List
+	statusBar        *statusBar
+	ws               *ws.Manager
+	handlers         *protocol.Registry
+	keys             *keymap.Keymap
+	commands         *commandRegistry
+	db               *data.Repository
+	cfg              *config.Config
+	theme            *theme.Theme
+	localUser        *data.LocalUser
+	credentialsMu    sync.Mutex
+	selectedFriend   *data.Friend
+	selectedGroup    *data.Group
+	addFriendBtn     *tview.Button
+	deleteFriendBtn  *tview.Button
+	editFriendBtn    *tview.Button
+	myDetailsButton  *tview.Button
+	groupsBtn        *tview.Button
+	attachBtn        *tview.Button
+	typing           *typingNotifier
+	typingExpiry     *time.Timer
+	friendTyping     bool
+	away             bool
+	onSwitchProfile  func()
+	lastMessageDate  time.Time
+	oldestMessage    int64
+	allLoaded        bool
+	rawText          bool
+	links            *linkRegions
+	outboxMu         sync.Mutex
+	paused           bool
+	closed           bool
+	held             []func()
+	attachments      *attachment.Client
+	transfers        map[int64]bool
+	transfersMu      sync.Mutex
+}
+
+func NewMainScreen(app *tview.Application, db *data.Repository, cfg *config.Config, theme *theme.Theme) *Main {
 	main := &Main{
 		app:              app,
 		internalTextView: tview.NewTextView(),
-		messageInput:     tview.NewInputField(),
-		commandBox:       tview.NewInputField(),
-		friendsList:      friendslist.New(),
+		messageInput:     composer.New(),
+		friendsList:      friendslist.New(theme),
+		statusBar:        newStatusBar(cfg.WebsocketURL, theme),
 		addFriendBtn:     tview.NewButton("Add Friend"),
 		deleteFriendBtn:  tview.NewButton("Delete Friend"),
 		editFriendBtn:    tview.NewButton("Edit Friend"),
 		myDetailsButton:  tview.NewButton("My Details"),
+		groupsBtn:        tview.NewButton("Groups"),
+		attachBtn:        tview.NewButton("Attach File"),
 		db:               db,
+		cfg:              cfg,
+		theme:            theme,
+		transfers:        map[int64]bool{},
+		links:            newLinkRegions(),
 	}
 
+	main.attachments = &attachment.Client{Endpoint: cfg.APIEndpoint, Token: main.getToken}
+
 	localUser, err := main.db.GetLocalUserInfo()
 	if err != nil {
 		log.Fatalf("couldn't get local user info: %s", err)
@@ -60,12 +108,30 @@ func NewMainScreen(app *tview.Application, db *data.Repository) *Main {
 
 	main.localUser = &localUser
 
+	main.keys, err = keymap.New(cfg.Keys)
+	if err != nil {
+		log.Fatalf("couldn't set up keybindings: %s", err)
+	}
+
+	err = main.ensureKeys()
+	if err != nil {
+		log.Fatalf("couldn't set up encryption keys: %s", err)
+	}
+
 	main.internalTextView.SetDynamicColors(true).
 		SetRegions(true).
 		SetWordWrap(true).SetBorder(true)
 	main.internalTextView.ScrollToEnd()
+	main.internalTextView.SetInputCapture(main.onChatKey)
+	main.internalTextView.SetMouseCapture(main.onChatMouse)
+	main.internalTextView.SetHighlightedFunc(main.onChatHighlight)
 
-	main.messageInput.SetDoneFunc(main.sendMessage).SetPlaceholder("Message")
+	main.typing = newTypingNotifier(main.sendTyping, func(f func()) { main.app.QueueUpdate(f) })
+
+	main.messageInput.SetDoneFunc(main.sendMessage).SetPlaceholder("Message, Alt+Enter starts a new line")
+	main.messageInput.SetChangedFunc(main.onMessageInputChanged)
+	main.messageInput.SetLinesChangedFunc(main.resizeMessageInput)
+	main.messageInput.SetInputCapture(main.onMessageInputKey)
 	main.messageInput.SetBorder(true)
 
 	main.friendsList.SetSelectedFunc(main.onFriendSelect)
@@ -74,85 +140,281 @@ func NewMainScreen(app *tview.Application, db *data.Repository) *Main {
 	main.deleteFriendBtn.SetSelectedFunc(main.showDeleteFriendScreen)
 	main.editFriendBtn.SetSelectedFunc(main.showEditFriendScreen)
 	main.myDetailsButton.SetSelectedFunc(main.showMyDetailsScreen)
+	main.groupsBtn.SetSelectedFunc(main.showGroupsScreen)
+	main.attachBtn.SetSelectedFunc(main.showFilePicker)
 
 	main.addFriendBtn.SetBorder(true)
 	main.deleteFriendBtn.SetBorder(true)
 	main.editFriendBtn.SetBorder(true)
 	main.myDetailsButton.SetBorder(true)
+	main.groupsBtn.SetBorder(true)
+	main.attachBtn.SetBorder(true)
+
+	// presence is only known while connected, the server sends it again once we are
+	main.db.ResetPresence()
 
 	main.loadFriendsList()
 	main.loadFirstFriend()
 
-	err = main.validateJWT()
+	main.registerHandlers()
+	main.registerCommands()
+
+	main.connect()
+
+	return main
+}
+
+// connect starts a new connection to the server.
+func (s *Main) connect() {
+	s.ws = ws.NewManager(s.cfg.WebsocketURL, s.getToken)
+	s.updateStatusBar()
+
+	go s.handleConnection(s.ws, s.ws.Subscribe())
+	go s.ws.Run()
+}
+
+// Pause disconnects from the server and forgets the local user's keys while the client is locked,
+// so no messages are received or decrypted until Resume is called.
+func (s *Main) Pause() {
+	s.typing.stop()
+	s.ws.Close()
+	s.paused = true
+
+	// tokens are fetched in the background, see getToken
+	s.credentialsMu.Lock()
+	s.localUser.Seed, s.localUser.PrivateKey, s.localUser.JWT = "", "", ""
+	s.credentialsMu.Unlock()
+}
+
+// Resume reads the local user's keys again and reconnects, the database has to be unlocked first.
+func (s *Main) Resume() {
+	localUser, err := s.db.GetLocalUserInfo()
 	if err != nil {
-		panic(err)
+		log.Fatalf("couldn't get local user info: %s", err)
 	}
 
-	main.loadMissedMessages()
+	s.credentialsMu.Lock()
+	*s.localUser = localUser
+	s.credentialsMu.Unlock()
 
-	connection, _ := ws.NewWebsocketClient(localUser.JWT)
+	s.paused = false
 
-	main.ws = connection
+	// payloads that arrived just before the client was locked are handled now that they can be decrypted
+	held := s.held
+	s.held = nil
 
-	if connection != nil {
-		main.isConnectionAlive = true
+	for _, f := range held {
+		f()
 	}
 
-	go main.listenForMessages()
+	s.connect()
+}
 
-	return main
+// SetSwitchProfileFunc sets the handler called when the user wants to switch to a different profile.
+func (s *Main) SetSwitchProfileFunc(handler func()) {
+	s.onSwitchProfile = handler
 }
 
-type Payload struct {
-	Type string
-	Msg  interface{}
+// Close disconnects from the server, the screen must not be used afterwards.
+func (s *Main) Close() {
+	s.ws.Close()
+	s.closed = true
 }
 
-// TODO: consider optimising this entire method
-func (s *Main) loadMissedMessages() {
-	messages := s.getMissedMessages()
+// ensureKeys derives the local user's keypair for accounts created before end-to-end encryption was introduced.
+func (s *Main) ensureKeys() error {
+	if s.localUser.PublicKey != "" && s.localUser.PrivateKey != "" {
+		return nil
+	}
 
-	for i := len(messages) - 1; i >= 0; i-- {
-		err := s.db.StoreMessage(messages[i].Sender, messages[i])
-		if err != nil {
-			log.Fatalf("couldn't store message: %s", err)
-		}
+	publicKey, privateKey, err := e2e.DeriveKeyPair(s.localUser.Seed)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.UpdateKeys(publicKey, privateKey)
+	if err != nil {
+		return err
+	}
 
-		if messages[i].Sender == s.selectedFriend.SellyID {
-			messages[i].Sender = s.selectedFriend.Username
-			s.addMessage(messages[i])
+	s.localUser.PublicKey = publicKey
+	s.localUser.PrivateKey = privateKey
 
-			s.db.UpdateLastInteraction(s.selectedFriend.SellyID)
-		} else {
-			friend, _ := s.db.GetFriendDataBySellyID(messages[i].Sender)
+	return nil
+}
 
-			s.friendsList.IncrementUnreadMessages(friend.Username)
+func (s *Main) sendKeyExchange(sellyId string, request bool) {
+	if !s.ws.IsConnected() {
+		return
+	}
+
+	s.send(protocol.TypeKeyExchange, protocol.KeyExchange{
+		Sender:    s.localUser.SellyID,
+		Receiver:  sellyId,
+		PublicKey: s.localUser.PublicKey,
+		Request:   request,
+	})
+}
+
+// exchangeMissingKeys asks every friend whose public key we don't know yet for it.
+func (s *Main) exchangeMissingKeys() {
+	friends, err := s.db.GetFriends()
+	if err != nil {
+		return
+	}
 
-			s.db.UpdateLastInteraction(friend.SellyID)
+	for _, friend := range friends {
+		if friend.PublicKey == "" {
+			s.sendKeyExchange(friend.SellyID, true)
 		}
 	}
 }
 
-func (s *Main) getMissedMessages() []data.Message {
-	req, _ := http.NewRequest(http.MethodGet, "http://localhost:8082/v1/users/missed-messages", nil)
+func (s *Main) readKeyExchange(envelope protocol.Envelope) error {
+	var keyExchange protocol.KeyExchange
+
+	if err := envelope.DecodeMsg(&keyExchange); err != nil {
+		return err
+	}
+
+	friend, err := s.db.GetFriendDataBySellyID(keyExchange.Sender)
+	if err != nil {
+		return err
+	}
+
+	if keyExchange.Request {
+		s.sendKeyExchange(friend.SellyID, false)
+	}
+
+	// a key that's already known needs nothing, unless the friend went back to the accepted key
+	if keyExchange.PublicKey == friend.PendingPublicKey || keyExchange.PublicKey == friend.PublicKey && friend.PendingPublicKey == "" {
+		return nil
+	}
+
+	// the first key is trusted, a changed one is kept aside until the user accepts it
+	if friend.PublicKey == "" || keyExchange.PublicKey == friend.PublicKey {
+		err = s.db.UpdateFriendPublicKey(friend.SellyID, keyExchange.PublicKey)
+	} else {
+		err = s.db.SetPendingPublicKey(friend.SellyID, keyExchange.PublicKey)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := s.refreshFriend(friend.SellyID); err != nil {
+		return err
+	}
+
+	if friend.PublicKey != "" && keyExchange.PublicKey != friend.PublicKey {
+		s.addErrorMessage(fmt.Sprintf("the security key of %s has changed, messages to them are held until you accept it with /accept-key %s", friend.Username, friend.Username))
+	}
+
+	return nil
+}
+
+// refreshFriend shows the stored key state of a friend after it changed and sends the messages that were
+// held back for them.
+func (s *Main) refreshFriend(sellyId string) error {
+	friend, err := s.db.GetFriendDataBySellyID(sellyId)
+	if err != nil {
+		return err
+	}
+
+	if s.selectedFriend != nil && s.selectedFriend.SellyID == friend.SellyID {
+		s.selectedFriend.PublicKey = friend.PublicKey
+		s.selectedFriend.PendingPublicKey = friend.PendingPublicKey
+	}
+
+	s.friendsList.SetUnverified(friend.Username, friend.PendingPublicKey != "")
+
+	if friend.PendingPublicKey == "" && s.flushOutbox() {
+		s.reloadMessages()
+	}
+
+	return nil
+}
+
+// acceptKey accepts the new security key of a friend, the messages held back for them are sent with it.
+func (s *Main) acceptKey(friend data.Friend) error {
+	if friend.PendingPublicKey == "" {
+		return fmt.Errorf("the security key of %s hasn't changed", friend.Username)
+	}
+
+	if err := s.db.AcceptPendingPublicKey(friend.SellyID); err != nil {
+		return err
+	}
+
+	s.addNoticeMessage(fmt.Sprintf("accepted the new security key of %s", friend.Username))
+
+	return s.refreshFriend(friend.SellyID)
+}
+
+// decryptMessage replaces the contents of an incoming message with its plaintext.
+func (s *Main) decryptMessage(message *data.Message, publicKey string) {
+	plaintext, err := e2e.Decrypt(message.Message, publicKey, s.localUser.PrivateKey)
+	if err != nil {
+		message.Message = "[couldn't decrypt message]"
+		return
+	}
+
+	message.Message = plaintext
+}
+
+// loadMissedMessages fetches the messages sent while we were offline, which are only available through the
+// API. The request is made in the background, the messages are received on the UI goroutine.
+//
+// TODO: consider optimising this entire method
+func (s *Main) loadMissedMessages() {
+	go func() {
+		var messages []protocol.Message
+
+		token, err := s.getToken()
+		if err == nil {
+			messages, err = s.getMissedMessages(token)
+		}
+
+		s.app.QueueUpdateDraw(func() {
+			s.whenUnpaused(func() {
+				if err != nil {
+					s.addErrorMessage(fmt.Sprintf("couldn't fetch missed messages: %s", err))
+					return
+				}
+
+				for i := len(messages) - 1; i >= 0; i-- {
+					s.receiveMessage(messages[i])
+				}
+			})
+		})
+	}()
+}
+
+func (s *Main) getMissedMessages(token string) ([]protocol.Message, error) {
+	req, err := http.NewRequest(http.MethodGet, s.cfg.APIEndpoint("/v1/users/missed-messages"), nil)
+	if err != nil {
+		return nil, err
+	}
 
-	req.Header.Add("Authorization", "Bearer "+s.localUser.JWT)
+	req.Header.Add("Authorization", "Bearer "+token)
 
 	client := &http.Client{}
-	r, _ := client.Do(req)
+	r, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
 
 	var response struct {
-		Messages []data.Message `json:"messages"`
+		Messages []protocol.Message `json:"messages"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
-	err := decoder.Decode(&response)
+	err = decoder.Decode(&response)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	return response.Messages
-
+	return response.Messages, nil
 }
 
 func (s *Main) deleteFriend(username string) {
@@ -165,12 +427,20 @@ func (s *Main) deleteFriend(username string) {
 }
 
 func (s *Main) showDeleteFriendScreen() {
+	if s.selectedFriend == nil {
+		return
+	}
+
+	s.confirmDeleteFriend(s.selectedFriend.Username)
+}
+
+func (s *Main) confirmDeleteFriend(username string) {
 	modal := tview.NewModal().
-		SetText(fmt.Sprintf("Are you sure that you would like to remove %s from your friend's list?", s.selectedFriend.Username)).
+		SetText(fmt.Sprintf("Are you sure that you would like to remove %s from your friend's list?", tview.Escape(username))).
 		AddButtons([]string{"Yes", "No"}).
 		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 			if buttonLabel == "Yes" {
-				s.deleteFriend(s.selectedFriend.Username)
+				s.deleteFriend(username)
 			}
 
 			s.app.SetRoot(s.Render(), true)
@@ -181,10 +451,24 @@ func (s *Main) showDeleteFriendScreen() {
 
 func (s *Main) showMyDetailsScreen() {
 	modal := tview.NewModal().SetText(fmt.Sprintf("Your SellyID is: %s\n\n Your seed is: %s", s.localUser.SellyID, s.localUser.Seed)).
-		AddButtons([]string{"Copy SellyID", "Copy Seed", "Export Account", "Back"}).
+		AddButtons([]string{"Copy SellyID", "Copy Seed", "Export Account", "Passphrase", "Switch Profile", "Back"}).
 		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 			if buttonLabel == "Back" {
 				s.app.SetRoot(s.Render(), true)
+				return
+			}
+
+			if buttonLabel == "Passphrase" {
+				s.showPassphraseScreen()
+				return
+			}
+
+			if buttonLabel == "Switch Profile" {
+				if s.onSwitchProfile != nil {
+					s.onSwitchProfile()
+				}
+
+				return
 			}
 
 			err := clipboard.Init()
@@ -211,6 +495,56 @@ func (s *Main) showMyDetailsScreen() {
 	s.app.SetRoot(modal, true)
 }
 
+func (s *Main) showPassphraseScreen() {
+	form := tview.NewForm()
+
+	if s.db.HasPassphrase() {
+		form.AddPasswordField("Current passphrase", "", 0, '*', nil)
+	}
+
+	form.AddPasswordField("New passphrase", "", 0, '*', nil).
+		AddPasswordField("Confirm passphrase", "", 0, '*', nil)
+
+	offset := form.GetFormItemCount() - 2
+	newPassphraseField := form.GetFormItem(offset).(*tview.InputField)
+	confirmPassphraseField := form.GetFormItem(offset + 1).(*tview.InputField)
+	newPassphraseField.SetPlaceholder("leave empty to remove the passphrase")
+
+	form.AddButton("Save", func() {
+		if newPassphraseField.GetText() != confirmPassphraseField.GetText() {
+			confirmPassphraseField.SetText("")
+			confirmPassphraseField.SetPlaceholder("passphrases don't match")
+			return
+		}
+
+		var currentPassphrase string
+		if s.db.HasPassphrase() {
+			currentPassphrase = form.GetFormItem(0).(*tview.InputField).GetText()
+		}
+
+		err := s.db.ChangePassphrase(currentPassphrase, newPassphraseField.GetText())
+		if errors.Is(err, data.ErrWrongPassphrase) {
+			currentPassphraseField := form.GetFormItem(0).(*tview.InputField)
+			currentPassphraseField.SetText("")
+			currentPassphraseField.SetPlaceholder("wrong passphrase")
+			return
+		}
+
+		if err != nil {
+			log.Fatalf("couldn't change passphrase: %s", err)
+		}
+
+		s.app.SetRoot(s.Render(), true)
+	})
+
+	form.AddButton("Cancel", func() {
+		s.app.SetRoot(s.Render(), true)
+	})
+
+	form.SetBorder(true).SetTitle("Passphrase").SetTitleAlign(tview.AlignLeft)
+	s.app.SetRoot(form, true)
+}
+
 func (s *Main) exportAccount() {
 	var acc struct {
 		ID   string `json:"id"`
@@ -234,22 +568,26 @@ func (s *Main) showEditFriendScreen() {
 			usernameField := form.GetFormItem(0).(*tview.InputField)
 			sellyIDField := form.GetFormItem(1).(*tview.InputField)
 
-			isUsernameValid, err := validateUsernameInput(usernameField)
-			if !isUsernameValid {
+			usernameErr := s.validateNewUsername(usernameField.GetText(), s.selectedFriend.Username)
+			if usernameErr != nil {
 				usernameField.SetText("")
-				usernameField.SetPlaceholder(err)
+				usernameField.SetPlaceholder(usernameErr.Error())
 			}
 
-			isSellyIDValid, err := validateSellyID(sellyIDField)
-			if !isSellyIDValid {
+			sellyIDErr := s.validateNewSellyID(sellyIDField.GetText(), s.selectedFriend.SellyID)
+			if sellyIDErr != nil {
 				sellyIDField.SetText("")
-				sellyIDField.SetPlaceholder(err)
+				sellyIDField.SetPlaceholder(sellyIDErr.Error())
 			}
 
-			if isUsernameValid && isSellyIDValid {
-				s.editFriend(usernameField.GetText(), sellyIDField.GetText())
+			if usernameErr == nil && sellyIDErr == nil {
+				err := s.editFriend(*s.selectedFriend, usernameField.GetText(), sellyIDField.GetText())
 
 				s.app.SetRoot(s.Render(), true)
+
+				if err != nil {
+					s.addErrorMessage(fmt.Sprintf("couldn't edit %s: %s", s.selectedFriend.Username, err))
+				}
 			}
 		})
 
@@ -262,13 +600,30 @@ func (s *Main) showEditFriendScreen() {
 	}
 }
 
-func (s *Main) editFriend(username, sellyID string) {
-	s.friendsList.EditFriendText(s.selectedFriend.Username, username, sellyID)
+func (s *Main) editFriend(friend data.Friend, username, sellyID string) error {
+	if err := s.db.EditFriend(friend.SellyID, sellyID, username); err != nil {
+		return err
+	}
+
+	s.friendsList.EditFriendText(friend.Username, username, sellyID)
 
-	err := s.db.EditFriend(s.selectedFriend.SellyID, sellyID, username)
-	if err != nil {
-		panic(err)
+	if s.selectedFriend != nil && s.selectedFriend.SellyID == friend.SellyID {
+		s.selectedFriend.Username = username
+		s.updateChatTitle()
+	}
+
+	// the stored key belongs to the old SellyID, a new one has to be exchanged
+	if sellyID != friend.SellyID {
+		if err := s.db.UpdateFriendPublicKey(sellyID, ""); err != nil {
+			return err
+		}
+
+		s.friendsList.SetUnverified(username, false)
+
+		s.sendKeyExchange(sellyID, true)
 	}
+
+	return nil
 }
 
 func (s *Main) showAddFriendScreen() {
@@ -280,23 +635,28 @@ func (s *Main) showAddFriendScreen() {
 		usernameField := form.GetFormItem(0).(*tview.InputField)
 		sellyIDField := form.GetFormItem(1).(*tview.InputField)
 
-		isUsernameValid, err := validateUsernameInput(usernameField)
-		if !isUsernameValid {
+		usernameErr := s.validateNewUsername(usernameField.GetText(), "")
+		if usernameErr != nil {
 			usernameField.SetText("")
-			usernameField.SetPlaceholder(err)
+			usernameField.SetPlaceholder(usernameErr.Error())
 		}
 
-		isSellyIDValid, err := validateSellyID(sellyIDField)
-		if !isSellyIDValid {
+		sellyIDErr := s.validateNewSellyID(sellyIDField.GetText(), "")
+		if sellyIDErr != nil {
 			sellyIDField.SetText("")
-			sellyIDField.SetPlaceholder(err)
+			sellyIDField.SetPlaceholder(sellyIDErr.Error())
 		}
 
-		if isUsernameValid && isSellyIDValid {
-			s.addFriend(usernameField.GetText(), sellyIDField.GetText())
+		if usernameErr == nil && sellyIDErr == nil {
+			err := s.addFriend(usernameField.GetText(), sellyIDField.GetText())
 
 			s.app.SetRoot(s.Render(), true)
 
+			if err != nil {
+				s.addErrorMessage(fmt.Sprintf("couldn't add %s: %s", usernameField.GetText(), err))
+				return
+			}
+
 			s.db.UpdateLastInteraction(sellyIDField.GetText())
 		}
 	})
@@ -309,53 +669,32 @@ func (s *Main) showAddFriendScreen() {
 	s.app.SetRoot(form, true)
 }
 
-func (s *Main) addFriend(username, sellyID string) {
-	s.friendsList.AddFriend(username, sellyID)
-
-	err := s.db.AddFriend(sellyID, username)
-	if err != nil {
-		panic(err)
+func (s *Main) addFriend(username, sellyID string) error {
+	if err := s.db.AddFriend(sellyID, username); err != nil {
+		return err
 	}
-}
-
-func (s *Main) validateJWT() error {
-	if s.localUser.JWT == "" {
-		hashedSeed := s.localUser.GetHashedSeed()
-
-		token, err := s.getNewToken(hashedSeed)
-		if err != nil {
-			return err
-		}
 
-		err = s.db.UpdateJWT(token)
-		if err != nil {
-			return err
-		}
+	s.friendsList.AddFriend(username, sellyID)
+	s.sendKeyExchange(sellyID, true)
 
-		s.localUser.JWT = token
+	return nil
+}
 
-		return nil
+// validToken returns token if it's still valid, otherwise a new one, which is requested with hashedSeed.
+func (s *Main) validToken(hashedSeed, token string) (string, error) {
+	if token == "" {
+		return s.getNewToken(hashedSeed)
 	}
 
-	if jwt.IsExpired(s.localUser.JWT) {
-		token, err := s.refreshToken(s.localUser.JWT)
-		if err != nil {
-			return err
-		}
-
-		err = s.db.UpdateJWT(token)
-		if err != nil {
-			return err
-		}
-
-		s.localUser.JWT = token
+	if jwt.IsExpired(token) {
+		return s.refreshToken(token)
 	}
 
-	return nil
+	return token, nil
 }
 
 func (s *Main) getNewToken(sellyId string) (string, error) {
-	req, err := http.NewRequest(http.MethodGet, "http://localhost:8082/v1/users/token?id="+sellyId, nil)
+	req, err := http.NewRequest(http.MethodGet, s.cfg.APIEndpoint("/v1/users/token?id="+sellyId), nil)
 	if err != nil {
 		return "", err
 	}
@@ -380,7 +719,7 @@ func (s *Main) getNewToken(sellyId string) (string, error) {
 }
 
 func (s *Main) refreshToken(jwt string) (string, error) {
-	req, err := http.NewRequest(http.MethodGet, "http://localhost:8082/v1/users/refresh-token", nil)
+	req, err := http.NewRequest(http.MethodGet, s.cfg.APIEndpoint("/v1/users/refresh-token"), nil)
 	if err != nil {
 		panic(err)
 	}
@@ -424,198 +763,1090 @@ func (s *Main) loadFriendsList() {
 		log.Fatalf("couldn't fetch friends: %s", err)
 	}
 
-	for _, friend := range friends {
-		s.friendsList.AddFriend(friend.Username, friend.SellyID)
-
-		unreadMessagesCount := s.db.GetCountOfUnreadMessages(friend.SellyID)
+	groups, err := s.db.GetGroupsSorted()
+	if err != nil {
+		log.Fatalf("couldn't fetch groups: %s", err)
+	}
 
-		s.friendsList.SetUnreadCounter(friend.Username, unreadMessagesCount)
+	// both are sorted by their last interaction, merging them keeps the most recent conversations on top
+	for len(friends) > 0 || len(groups) > 0 {
+		if len(groups) == 0 || (len(friends) > 0 && friends[0].LastInteraction >= groups[0].LastInteraction) {
+			s.addFriendToList(friends[0])
+			friends = friends[1:]
+		} else {
+			s.addGroupToList(groups[0])
+			groups = groups[1:]
+		}
 	}
 }
 
+func (s *Main) addFriendToList(friend data.Friend) {
+	s.friendsList.AddFriend(friend.Username, friend.SellyID)
+
+	unreadMessagesCount := s.db.GetCountOfUnreadMessages(friend.SellyID)
+
+	s.friendsList.SetUnreadCounter(friend.Username, unreadMessagesCount)
+	s.friendsList.SetPresence(friend.Username, friend.Presence)
+	s.friendsList.SetUnverified(friend.Username, friend.PendingPublicKey != "")
+}
+
 func (s *Main) onFriendSelect(node *tview.TreeNode) {
 	s.friendsList.SanitizeNode(node)
 
-	userParts := strings.Split(node.GetText(), " ")
+	s.typing.stop()
 
-	friendData, err := s.db.GetFriendDataByUsername(userParts[0])
-	if err != nil {
-		log.Fatalf("couldn't get friend info: %s", err)
-	}
+	if s.friendsList.IsGroup(node) {
+		group, err := s.db.GetGroup(s.friendsList.GetGroupID(node))
+		if err != nil {
+			log.Fatalf("couldn't get group info: %s", err)
+		}
+
+		s.selectedFriend = nil
+		s.selectedGroup = &group
+	} else {
+		friendData, err := s.db.GetFriendDataByUsername(s.friendsList.GetUsername(node))
+		if err != nil {
+			log.Fatalf("couldn't get friend info: %s", err)
+		}
 
-	s.selectedFriend = &friendData
+		s.selectedFriend = &friendData
+		s.selectedGroup = nil
+	}
 
-	s.internalTextView.SetTitle(friendData.Username)
+	s.showTyping(false)
 	s.internalTextView.SetText("")
+	s.internalTextView.Highlight().ScrollToEnd()
+	s.lastMessageDate = time.Time{}
 
-	s.db.SetRead(friendData.SellyID)
+	s.markAsRead(s.conversationID())
 
 	s.loadMessages()
-}
 
-func (s *Main) loadMessages() {
-	messages, err := s.db.GetMessages(s.selectedFriend.SellyID)
-	if err != nil {
-		log.Fatalf("couldn't get messages: %s", err)
+	if s.selectedFriend != nil && s.selectedFriend.PendingPublicKey != "" {
+		s.addErrorMessage(fmt.Sprintf("the security key of %s has changed, messages to them are held until you accept it with /accept-key %s", s.selectedFriend.Username, s.selectedFriend.Username))
 	}
+}
 
-	for _, message := range messages {
-		if message.Sender == s.localUser.SellyID {
-			message.Sender = "You"
-		} else {
-			friend, err := s.db.GetFriendDataBySellyID(message.Sender)
-			if err != nil {
-				log.Fatalf("couldn't find friend: %s", err)
-			}
+// conversationID returns the SellyID of the selected friend or the ID of the selected group,
+// messages are stored under it.
+func (s *Main) conversationID() string {
+	switch {
+	case s.selectedFriend != nil:
+		return s.selectedFriend.SellyID
+	case s.selectedGroup != nil:
+		return s.selectedGroup.GroupID
+	}
 
-			message.Sender = friend.Username
-		}
+	return ""
+}
 
-		s.addMessage(message)
+// reloadMessages renders the selected conversation's messages again, e.g. after their status changed.
+// The pages that were already loaded stay loaded.
+func (s *Main) reloadMessages() {
+	if s.conversationID() == "" {
+		return
 	}
-}
 
-func (s *Main) retryConnection() {
-	time.Sleep(1 * time.Second)
+	if s.oldestMessage == 0 {
+		s.internalTextView.SetText("")
+		s.lastMessageDate = time.Time{}
 
-	s.validateJWT()
-	conn, _ := ws.NewWebsocketClient(s.localUser.JWT)
-	if conn == nil {
-		s.listenForMessages()
+		s.loadMessages()
 		return
 	}
 
-	s.ws = conn
-	s.isConnectionAlive = true
-	s.addSuccessMessage("connection restored")
-	s.app.Draw()
-}
+	messages, err := s.db.GetMessagesFrom(s.conversationID(), s.oldestMessage)
+	if err != nil {
+		log.Fatalf("couldn't get messages: %s", err)
+	}
 
-func (s *Main) listenForMessages() {
-	var msg json.RawMessage
-	payload := Payload{Msg: &msg}
+	s.internalTextView.SetText("")
+	s.lastMessageDate = time.Time{}
 
-	if !s.isConnectionAlive {
-		s.retryConnection()
-	}
+	s.addMessages(messages)
+}
 
-	for {
-		err := s.ws.ReadJSON(&payload)
-		if err != nil {
-			if s.isConnectionAlive {
-				s.addErrorMessage("connection lost")
-				s.app.Draw()
-			}
+// loadMessages shows the latest page of the selected conversation's messages.
+func (s *Main) loadMessages() {
+	messages, err := s.db.GetMessagesBefore(s.conversationID(), 0, messagesPageSize)
+	if err != nil {
+		log.Fatalf("couldn't get messages: %s", err)
+	}
 
-			s.isConnectionAlive = false
-			s.listenForMessages()
-			return
-		}
+	s.oldestMessage = 0
+	s.allLoaded = len(messages) < messagesPageSize
 
-		if s.isConnectionAlive {
-			switch payload.Type {
-			case messageType:
-				s.readIncomingMessage(msg)
-			default:
-				log.Fatal("unknown message type")
-			}
-		}
+	if len(messages) > 0 {
+		s.oldestMessage = messages[0].RowID
 	}
+
+	s.addMessages(messages)
 }
 
-func (s *Main) readIncomingMessage(msg json.RawMessage) {
-	var message data.Message
+// loadOlderMessages loads the page before the oldest message shown, keeping the messages that were
+// at the top of the chat in view.
+func (s *Main) loadOlderMessages() {
+	if s.allLoaded || s.oldestMessage == 0 {
+		return
+	}
 
-	if err := json.Unmarshal(msg, &message); err != nil {
-		log.Fatal(err)
+	messages, err := s.db.GetMessagesBefore(s.conversationID(), s.oldestMessage, messagesPageSize)
+	if err != nil {
+		log.Fatalf("couldn't get messages: %s", err)
 	}
 
-	friendData, _ := s.db.GetFriendDataBySellyID(message.Sender)
+	s.allLoaded = len(messages) < messagesPageSize
 
-	if message.Sender == s.selectedFriend.SellyID {
-		message.Read = 1
+	if len(messages) == 0 {
+		return
+	}
 
-		err := s.db.StoreMessage(message.Sender, message)
-		if err != nil {
-			log.Fatalf("couldn't store message: %s", err)
-		}
+	s.oldestMessage = messages[0].RowID
 
-		message.Sender = friendData.Username
+	row, _ := s.internalTextView.GetScrollOffset()
+	lines := s.internalTextView.GetOriginalLineCount()
 
-		s.addMessage(message)
+	s.reloadMessages()
 
-		s.app.Draw()
-	} else {
-		message.Read = 0
+	// wrapped messages take up more rows than lines, so this scrolls a little short of where we were
+	s.internalTextView.ScrollTo(row+s.internalTextView.GetOriginalLineCount()-lines, 0)
+}
 
-		err := s.db.StoreMessage(message.Sender, message)
-		if err != nil {
-			log.Fatalf("couldn't store message: %s", err)
+// clearMessages empties the chat window, only messages that arrive afterwards are shown until another
+// conversation is selected.
+func (s *Main) clearMessages() {
+	s.internalTextView.SetText("")
+	s.lastMessageDate = time.Time{}
+
+	if s.conversationID() == "" {
+		return
+	}
+
+	s.oldestMessage = s.db.GetLastMessageRowID(s.conversationID()) + 1
+	s.allLoaded = true
+}
+
+// loadMessagesFrom makes sure every message starting with the one with the RowID from is shown.
+func (s *Main) loadMessagesFrom(from int64) {
+	if s.oldestMessage != 0 && from >= s.oldestMessage {
+		return
+	}
+
+	s.oldestMessage = from
+	s.allLoaded = false
+
+	s.reloadMessages()
+}
+
+func (s *Main) addMessages(messages []data.Message) {
+	for _, message := range messages {
+		s.addMessage(message, s.displayName(message.Sender, message.SenderName))
+	}
+}
+
+// onChatKey loads older messages when the user tries to scroll past the top of the chat.
+func (s *Main) onChatKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyUp, tcell.KeyPgUp, tcell.KeyHome, tcell.KeyCtrlB:
+		if row, _ := s.internalTextView.GetScrollOffset(); row <= 0 {
+			s.loadOlderMessages()
 		}
+	}
 
-		s.friendsList.IncrementUnreadMessages(friendData.Username)
+	return event
+}
 
-		s.app.Draw()
+func (s *Main) onChatMouse(action tview.MouseAction, event *tcell.EventMouse) (tview.MouseAction, *tcell.EventMouse) {
+	if action == tview.MouseScrollUp {
+		if row, _ := s.internalTextView.GetScrollOffset(); row <= 0 {
+			s.loadOlderMessages()
+		}
 	}
 
-	s.db.UpdateLastInteraction(friendData.SellyID)
+	return action, event
 }
 
-func (s *Main) sendMessage(key tcell.Key) {
-	if key == tcell.KeyEnter && s.messageInput.GetText() != "" && s.isConnectionAlive {
-		s.validateJWT()
+// senderName returns the name shown next to messages from sellyId.
+func (s *Main) senderName(sellyId string) string {
+	var username string
+
+	if friend, err := s.db.GetFriendDataBySellyID(sellyId); err == nil {
+		username = friend.Username
+	}
+
+	return s.displayName(sellyId, username)
+}
+
+// displayName returns the name shown next to messages from sellyId, whose username is empty if they
+// aren't a friend. Group members who aren't friends are shown by their truncated SellyID.
+func (s *Main) displayName(sellyId, username string) string {
+	if sellyId == s.localUser.SellyID {
+		return "You"
+	}
+
+	if username != "" {
+		return username
+	}
+
+	if len(sellyId) > 7 {
+		return sellyId[:7] + "..."
+	}
+
+	return sellyId
+}
+
+// publicKeyOf returns the public key of a friend or, if they aren't a friend, the key they were invited to
+// the group with. The key of a friend is only ever taken from their own key exchange.
+func (s *Main) publicKeyOf(sellyId, groupId string) string {
+	friend, err := s.db.GetFriendDataBySellyID(sellyId)
+	if err == nil {
+		return friend.PublicKey
+	}
+
+	if groupId == "" {
+		return ""
+	}
+
+	member, err := s.db.GetGroupMember(groupId, sellyId)
+	if err != nil {
+		return ""
+	}
+
+	return member.PublicKey
+}
+
+func (s *Main) isFriend(sellyId string) bool {
+	_, err := s.db.GetFriendDataBySellyID(sellyId)
+
+	return err == nil
+}
+
+// sendingKeyOf returns the key messages to sellyId are encrypted with, which is empty while a new key of
+// theirs waits to be accepted, so the messages are held back.
+func (s *Main) sendingKeyOf(sellyId, groupId string) string {
+	if friend, err := s.db.GetFriendDataBySellyID(sellyId); err == nil && friend.PendingPublicKey != "" {
+		return ""
+	}
 
-		message := data.Message{
-			Sender:   s.localUser.SellyID,
-			Receiver: s.selectedFriend.SellyID,
-			Message:  s.messageInput.GetText(),
+	return s.publicKeyOf(sellyId, groupId)
+}
+
+// receivingKeyOf returns the key that decrypts msg. A friend whose key changed already encrypts with the
+// new one, it's used to read their messages while the user hasn't accepted it yet.
+func (s *Main) receivingKeyOf(msg protocol.Message) string {
+	publicKey := s.publicKeyOf(msg.Sender, msg.GroupID)
+
+	friend, err := s.db.GetFriendDataBySellyID(msg.Sender)
+	if err != nil || friend.PendingPublicKey == "" {
+		return publicKey
+	}
+
+	if _, err := e2e.Decrypt(msg.Message, publicKey, s.localUser.PrivateKey); err == nil {
+		return publicKey
+	}
+
+	return friend.PendingPublicKey
+}
+
+// getToken returns a valid JWT, it's called before every connection attempt and attachment transfer, off the
+// UI goroutine. The token is requested without holding credentialsMu, so locking the client doesn't wait for
+// the server, and one requested while the client was being locked is thrown away.
+func (s *Main) getToken() (string, error) {
+	s.credentialsMu.Lock()
+	seed, token := s.localUser.Seed, s.localUser.JWT
+	hashedSeed := s.localUser.GetHashedSeed()
+	s.credentialsMu.Unlock()
+
+	if seed == "" {
+		return "", errPaused
+	}
+
+	newToken, err := s.validToken(hashedSeed, token)
+	if err != nil || newToken == token {
+		return newToken, err
+	}
+
+	s.credentialsMu.Lock()
+	defer s.credentialsMu.Unlock()
+
+	if s.localUser.Seed != seed {
+		return "", errPaused
+	}
+
+	if err := s.db.UpdateJWT(newToken); err != nil {
+		return "", err
+	}
+
+	s.localUser.JWT = newToken
+
+	return newToken, nil
+}
+
+// refreshTokenInBackground makes sure the stored token is still valid when it's needed next, without
+// blocking the UI while it's requested.
+func (s *Main) refreshTokenInBackground() {
+	go func() {
+		if _, err := s.getToken(); err != nil && !errors.Is(err, errPaused) {
+			s.app.QueueUpdateDraw(func() {
+				s.addErrorMessage(fmt.Sprintf("couldn't refresh the token: %s", err))
+			})
 		}
+	}()
+}
 
-		payload := Payload{
-			Type: messageType,
-			Msg:  message,
+// handleConnection processes incoming payloads and connection state changes of manager until it's closed.
+// They're handled on the UI goroutine, as they change what's shown and the state of the screen.
+func (s *Main) handleConnection(manager *ws.Manager, events <-chan ws.Event) {
+	messages := manager.Messages()
+
+	// refreshes the reconnection countdown in the status bar
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			s.app.QueueUpdateDraw(func() {
+				s.onConnectionEvent(manager, event)
+			})
+		case <-ticker.C:
+			if manager.State().State == ws.Reconnecting {
+				s.app.QueueUpdateDraw(s.updateStatusBar)
+			}
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			s.app.QueueUpdateDraw(func() {
+				s.whenUnpaused(func() {
+					s.handlePayload(message)
+				})
+			})
 		}
+	}
+}
+
+func (s *Main) onConnectionEvent(manager *ws.Manager, event ws.Event) {
+	// events of a connection that has been replaced, e.g. after the client was locked, are stale
+	if manager != s.ws || s.closed {
+		return
+	}
 
-		s.ws.WriteJSON(payload)
+	s.updateStatusBar()
 
-		message.DateCrated = time.Now().Unix()
-		message.Read = 1
+	if event.State != ws.Connected {
+		s.db.ResetPresence()
+		s.friendsList.ResetPresence()
+		return
+	}
+
+	if s.paused {
+		return
+	}
+
+	s.sendPresence()
+	s.exchangeMissingKeys()
+	s.loadMissedMessages()
+
+	if s.flushOutbox() {
+		s.reloadMessages()
+	}
+
+	go s.uploadPendingAttachments()
+}
+
+// whenUnpaused runs f, which needs the local user's keys, right away or once the session is resumed if
+// it's paused. Nothing is run once the screen has been closed.
+func (s *Main) whenUnpaused(f func()) {
+	switch {
+	case s.closed:
+	case s.paused:
+		s.held = append(s.held, f)
+	default:
+		f()
+	}
+}
+
+func (s *Main) updateStatusBar() {
+	s.statusBar.update(s.ws.State(), s.db.CountOutbox())
+}
+
+func (s *Main) registerHandlers() {
+	s.handlers = protocol.NewRegistry()
+
+	s.handlers.Handle(protocol.TypeMessage, s.readIncomingMessage)
+	s.handlers.Handle(protocol.TypeKeyExchange, s.readKeyExchange)
+	s.handlers.Handle(protocol.TypeAck, s.readAck)
+	s.handlers.Handle(protocol.TypeTyping, s.readTyping)
+	s.handlers.Handle(protocol.TypePresence, s.readPresence)
+	s.handlers.Handle(protocol.TypeGroup, s.readGroup)
+	s.handlers.Handle(protocol.TypeError, s.readServerError)
+}
+
+func (s *Main) handlePayload(message []byte) {
+	// payloads we can't make sense of, such as types introduced by newer clients, are dropped
+	err := s.handlers.Dispatch(message)
+
+	var unknownType *protocol.UnknownTypeError
+	var unsupportedVersion *protocol.UnsupportedVersionError
+
+	switch {
+	case err == nil:
+	case errors.As(err, &unknownType), errors.As(err, &unsupportedVersion):
+		s.addErrorMessage(fmt.Sprintf("ignored a message from a newer client, %s, consider updating", err))
+	default:
+		s.addErrorMessage(fmt.Sprintf("couldn't handle a message from the server: %s", err))
+	}
+}
 
-		err := s.db.StoreMessage(s.selectedFriend.SellyID, message)
+func (s *Main) readIncomingMessage(envelope protocol.Envelope) error {
+	var msg protocol.Message
+
+	if err := envelope.DecodeMsg(&msg); err != nil {
+		return err
+	}
+
+	s.receiveMessage(msg)
+
+	return nil
+}
+
+// receiveMessage decrypts and stores a message sent to us directly or to one of our groups,
+// and shows it if its conversation is open.
+func (s *Main) receiveMessage(msg protocol.Message) {
+	message := fromWireMessage(msg)
+	message.DateCrated = normalizeTimestamp(message.DateCrated)
+
+	conversation := message.Sender
+	if msg.GroupID != "" {
+		// messages to groups we've left or from people who aren't members are dropped
+		if !s.db.IsGroupMember(msg.GroupID, s.localUser.SellyID) || !s.db.IsGroupMember(msg.GroupID, message.Sender) {
+			return
+		}
+
+		conversation = msg.GroupID
+	}
+
+	// a message can arrive twice, e.g. live and again as a missed message after a reconnect
+	if msg.ID != "" && s.db.HasMessage(conversation, message.Sender, msg.ID) {
+		return
+	}
+
+	publicKey := s.receivingKeyOf(msg)
+	s.decryptMessage(&message, publicKey)
+
+	if msg.Attachment != "" && msg.ID != "" {
+		a, err := s.storeReceivedAttachment(msg, publicKey)
 		if err != nil {
-			log.Fatalf("couldn't store message: %s", err)
+			message.Message = "[couldn't decrypt attachment]"
+		} else {
+			message.Attachment = &a
 		}
+	}
+
+	// messages are only read if the user can see them, they're marked as read once the user comes back
+	isSelected := s.conversationID() == conversation
+	isRead := isSelected && s.isChatVisible()
+	if isRead {
+		message.Read = 1
+	}
+
+	err := s.db.StoreMessage(conversation, message)
+	if err != nil {
+		log.Fatalf("couldn't store message: %s", err)
+	}
+
+	// group messages aren't acknowledged, the sender would get a receipt from every member
+	if msg.GroupID == "" {
+		s.sendReceipt(protocol.AckDelivered, message)
+
+		if isRead {
+			s.sendReceipt(protocol.AckRead, message)
+		}
+
+		if isSelected {
+			s.showTyping(false)
+		}
+	}
+
+	switch {
+	case isSelected:
+		s.addMessage(message, s.senderName(message.Sender))
+	case msg.GroupID != "":
+		s.friendsList.IncrementGroupUnreadMessages(msg.GroupID)
+	default:
+		friend, _ := s.db.GetFriendDataBySellyID(message.Sender)
+		s.friendsList.IncrementUnreadMessages(friend.Username)
+	}
+
+	if msg.GroupID != "" {
+		s.db.UpdateGroupLastInteraction(msg.GroupID)
+	} else {
+		s.db.UpdateLastInteraction(message.Sender)
+	}
+}
+
+// sendReceipt acknowledges an incoming message to its sender.
+func (s *Main) sendReceipt(status protocol.AckStatus, message data.Message) {
+	if message.ID == "" {
+		return
+	}
+
+	s.sendReceiptForIDs(status, message.Sender, []string{message.ID})
+}
+
+func (s *Main) sendReceiptForIDs(status protocol.AckStatus, sellyId string, ids []string) {
+	if !s.ws.IsConnected() || len(ids) == 0 {
+		return
+	}
+
+	s.send(protocol.TypeAck, protocol.Ack{
+		Sender:     s.localUser.SellyID,
+		Receiver:   sellyId,
+		MessageIDs: ids,
+		Status:     status,
+	})
+}
+
+// markAsRead marks every message from sellyId as read and lets them know.
+func (s *Main) markAsRead(sellyId string) {
+	ids, err := s.db.GetUnreadMessageIDs(sellyId)
+	if err != nil {
+		log.Fatalf("couldn't get unread messages: %s", err)
+	}
+
+	s.db.SetRead(sellyId)
+
+	s.sendReceiptForIDs(protocol.AckRead, sellyId, ids)
+}
+
+func (s *Main) readAck(envelope protocol.Envelope) error {
+	var ack protocol.Ack
+
+	if err := envelope.DecodeMsg(&ack); err != nil {
+		return err
+	}
+
+	var status int
+	switch ack.Status {
+	case protocol.AckDelivered:
+		status = data.StatusDelivered
+	case protocol.AckRead:
+		status = data.StatusRead
+	default:
+		return fmt.Errorf("unknown ack status %q", ack.Status)
+	}
+
+	err := s.db.UpdateMessageStatus(ack.Sender, ack.MessageIDs, status)
+	if err != nil {
+		log.Fatalf("couldn't update message status: %s", err)
+	}
+
+	if s.selectedFriend != nil && s.selectedFriend.SellyID == ack.Sender {
+		s.reloadMessages()
+	}
+
+	return nil
+}
+
+func (s *Main) onMessageInputChanged(text string) {
+	if s.selectedFriend == nil {
+		return
+	}
+
+	if text == "" {
+		s.typing.stop()
+		return
+	}
+
+	s.typing.typed(s.selectedFriend.SellyID)
+}
+
+func (s *Main) sendTyping(sellyId string, typing bool) {
+	if !s.ws.IsConnected() {
+		return
+	}
+
+	s.send(protocol.TypeTyping, protocol.Typing{
+		Sender:   s.localUser.SellyID,
+		Receiver: sellyId,
+		Typing:   typing,
+	})
+}
 
-		message.Sender = "You"
-		s.addMessage(message)
+func (s *Main) readTyping(envelope protocol.Envelope) error {
+	var typing protocol.Typing
+
+	if err := envelope.DecodeMsg(&typing); err != nil {
+		return err
+	}
+
+	if s.selectedFriend == nil || s.selectedFriend.SellyID != typing.Sender {
+		return nil
+	}
+
+	s.showTyping(typing.Typing)
+
+	return nil
+}
+
+// showTyping shows whether the selected friend is typing in the title of the chat.
+func (s *Main) showTyping(typing bool) {
+	if s.typingExpiry != nil {
+		s.typingExpiry.Stop()
+		s.typingExpiry = nil
+	}
+
+	s.friendTyping = typing
+	s.updateChatTitle()
+
+	if !typing {
+		return
+	}
+
+	s.typingExpiry = time.AfterFunc(typingExpiry, func() {
+		s.app.QueueUpdateDraw(func() {
+			if s.selectedFriend != nil {
+				s.friendTyping = false
+				s.updateChatTitle()
+			}
+		})
+	})
+}
+
+// updateChatTitle shows whether the selected friend is typing or, if they're offline, when they were last seen.
+// For groups it shows the number of members.
+func (s *Main) updateChatTitle() {
+	if s.selectedGroup != nil {
+		members, _ := s.db.GetGroupMembers(s.selectedGroup.GroupID)
+		s.internalTextView.SetTitle(fmt.Sprintf("%s (%d members)", tview.Escape(s.selectedGroup.Name), len(members)))
+		return
+	}
+
+	friend := s.selectedFriend
+
+	switch {
+	case s.friendTyping:
+		s.internalTextView.SetTitle(fmt.Sprintf("%s is typing…", tview.Escape(friend.Username)))
+	case friend.Presence == string(protocol.PresenceOffline) && friend.LastSeen > 0:
+		lastSeen := lastSeenLabel(time.Unix(friend.LastSeen, 0), time.Now(), s.cfg.TimeFormat)
+		s.internalTextView.SetTitle(fmt.Sprintf("%s (last seen %s)", tview.Escape(friend.Username), lastSeen))
+	default:
+		s.internalTextView.SetTitle(tview.Escape(friend.Username))
+	}
+}
+
+func (s *Main) readPresence(envelope protocol.Envelope) error {
+	var presence protocol.Presence
+
+	if err := envelope.DecodeMsg(&presence); err != nil {
+		return err
+	}
+
+	friend, err := s.db.GetFriendDataBySellyID(presence.Sender)
+	if err != nil {
+		return err
+	}
+
+	// the server only sets last_seen for friends who are offline, everyone else is being seen right now
+	lastSeen := presence.LastSeen
+	if lastSeen == 0 {
+		lastSeen = time.Now().Unix()
+	}
+
+	err = s.db.UpdateFriendPresence(friend.SellyID, string(presence.Status), lastSeen)
+	if err != nil {
+		log.Fatalf("couldn't store presence: %s", err)
+	}
+
+	s.friendsList.SetPresence(friend.Username, string(presence.Status))
+
+	if s.selectedFriend != nil && s.selectedFriend.SellyID == friend.SellyID {
+		s.selectedFriend.Presence = string(presence.Status)
+		s.selectedFriend.LastSeen = lastSeen
+
+		s.updateChatTitle()
+	}
+
+	return nil
+}
+
+// SetAway sets whether friends see the user as away, e.g. because the client has been idle for a while.
+func (s *Main) SetAway(away bool) {
+	if s.away == away {
+		return
+	}
+
+	s.away = away
+	s.sendPresence()
+
+	if !away {
+		s.markSelectedAsRead()
+	}
+}
+
+// isChatVisible reports whether the user can see the chat: the main screen is shown rather than another
+// screen or the lock screen, and they haven't been idle long enough to be away.
+func (s *Main) isChatVisible() bool {
+	if s.away {
+		return false
+	}
+
+	// the focus is in the main screen's layout, or one of its children, while it's shown
+	return s.layout != nil && s.layout.HasFocus()
+}
+
+// markSelectedAsRead marks the messages of the selected conversation as read, they arrived while the
+// user couldn't see them.
+func (s *Main) markSelectedAsRead() {
+	if s.conversationID() == "" || !s.isChatVisible() {
+		return
+	}
+
+	s.markAsRead(s.conversationID())
+}
+
+// sendPresence tells every friend whether the user is online or away.
+func (s *Main) sendPresence() {
+	if !s.ws.IsConnected() {
+		return
+	}
+
+	status := protocol.PresenceOnline
+	if s.away {
+		status = protocol.PresenceAway
+	}
+
+	s.send(protocol.TypePresence, protocol.Presence{
+		Sender: s.localUser.SellyID,
+		Status: status,
+	})
+}
+
+func (s *Main) readServerError(envelope protocol.Envelope) error {
+	var serverError protocol.Error
+
+	if err := envelope.DecodeMsg(&serverError); err != nil {
+		return err
+	}
+
+	s.addErrorMessage(serverError.Message)
+
+	return nil
+}
+
+// send wraps msg in an envelope of the given type and writes it to the server.
+func (s *Main) send(t protocol.Type, msg interface{}) error {
+	envelope, err := protocol.NewEnvelope(t, msg)
+	if err != nil {
+		return err
+	}
+
+	return s.ws.WriteJSON(envelope)
+}
+
+func (s *Main) sendMessage(key tcell.Key) {
+	if key != tcell.KeyEnter {
+		return
+	}
+
+	text := s.messageInput.GetText()
+
+	// a message starting with a slash is sent by doubling it, "//shrug" sends "/shrug"
+	switch {
+	case strings.HasPrefix(text, "//"):
+		text = text[1:]
+	case strings.HasPrefix(text, "/"):
+		s.runCommand(text)
+		return
+	}
+
+	if strings.TrimSpace(text) != "" && s.conversationID() != "" {
 		s.messageInput.SetText("")
+		s.sendText(text)
+	}
+}
 
-		s.db.UpdateLastInteraction(s.selectedFriend.SellyID)
-		s.friendsList.MoveToTop(s.selectedFriend.Username)
+// resizeMessageInput makes room for every line of the message being written, up to the composer's maximum.
+func (s *Main) resizeMessageInput(lines int) {
+	if s.chatColumn != nil {
+		s.chatColumn.ResizeItem(s.messageInput, lines+2, 0)
 	}
 }
 
+// onMessageInputKey completes commands when Tab is pressed.
+func (s *Main) onMessageInputKey(event *tcell.EventKey) *tcell.EventKey {
+	if event.Key() == tcell.KeyTab && strings.HasPrefix(s.messageInput.GetText(), "/") {
+		s.messageInput.SetText(s.completeCommand(s.messageInput.GetText()))
+		return nil
+	}
+
+	return event
+}
+
+// sendText sends a message to the selected conversation.
+func (s *Main) sendText(text string) {
+	conversation := s.conversationID()
+
+	message := data.Message{
+		ID:         data.NewMessageID(),
+		Sender:     s.localUser.SellyID,
+		Receiver:   conversation,
+		Message:    text,
+		DateCrated: time.Now().Unix(),
+		Read:       1,
+		IsGroup:    s.selectedGroup != nil,
+	}
+
+	// every message goes through the outbox, so nothing is lost if it can't be sent right away
+	err := s.db.QueueMessage(conversation, message)
+	if err != nil {
+		log.Fatalf("couldn't store message: %s", err)
+	}
+
+	s.moveConversationToTop()
+
+	s.flushOutbox()
+	s.reloadMessages()
+
+	if s.selectedFriend != nil && s.selectedFriend.PendingPublicKey != "" {
+		s.addErrorMessage(fmt.Sprintf("the security key of %s has changed, your messages will be sent once you accept it with /accept-key %s", s.selectedFriend.Username, s.selectedFriend.Username))
+	} else if s.selectedFriend != nil && s.selectedFriend.PublicKey == "" {
+		s.addErrorMessage(fmt.Sprintf("waiting for %s to come online to exchange security keys, your messages will be sent afterwards", s.selectedFriend.Username))
+		s.sendKeyExchange(s.selectedFriend.SellyID, true)
+	}
+}
+
+// moveConversationToTop records that the selected conversation was just used and moves it to the top of the list.
+func (s *Main) moveConversationToTop() {
+	if s.selectedGroup != nil {
+		s.db.UpdateGroupLastInteraction(s.selectedGroup.GroupID)
+		s.friendsList.MoveGroupToTop(s.selectedGroup.GroupID)
+		return
+	}
+
+	s.db.UpdateLastInteraction(s.selectedFriend.SellyID)
+	s.friendsList.MoveToTop(s.selectedFriend.Username)
+}
+
+// flushOutbox sends pending messages in the order they were written. It stops at the first error, e.g. a write error,
+// and messages to a friend whose key isn't known yet are held back along with every later message to them.
+// It returns whether any message was sent.
+func (s *Main) flushOutbox() bool {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+	defer s.updateStatusBar()
+
+	if !s.ws.IsConnected() {
+		return false
+	}
+
+	messages, err := s.db.GetOutbox()
+	if err != nil {
+		log.Fatalf("couldn't get outbox: %s", err)
+	}
+
+	if len(messages) > 0 {
+		s.refreshTokenInBackground()
+	}
+
+	heldBack := map[string]bool{}
+	sent := false
+
+	for _, message := range messages {
+		if heldBack[message.Receiver] {
+			continue
+		}
+
+		err := s.sendOutgoingMessage(message)
+		if errors.Is(err, errUnknownKey) || errors.Is(err, errAttachmentPending) {
+			heldBack[message.Receiver] = true
+			continue
+		}
+
+		if err != nil {
+			break
+		}
+
+		if err := s.db.MarkSent(message.ID); err != nil {
+			log.Fatalf("couldn't update outbox: %s", err)
+		}
+
+		sent = true
+	}
+
+	return sent
+}
+
+// sendOutgoingMessage encrypts a message from the outbox for its receiver and sends it. It returns
+// errUnknownKey if the receiver's key isn't known yet and errAttachmentPending if the message's
+// attachment is still being uploaded.
+func (s *Main) sendOutgoingMessage(message data.Message) error {
+	msg := toWireMessage(message)
+
+	var err error
+	msg.Attachment, err = s.wireAttachment(message.ID)
+	if err != nil {
+		return err
+	}
+
+	if message.IsGroup {
+		return s.sendGroupMessage(msg)
+	}
+
+	publicKey := s.sendingKeyOf(message.Receiver, "")
+	if publicKey == "" {
+		return errUnknownKey
+	}
+
+	sealed, err := s.sealMessage(msg, publicKey)
+	if err != nil {
+		return errUnknownKey
+	}
+
+	return s.send(protocol.TypeMessage, sealed)
+}
+
+// sealMessage encrypts the text and attachment of a message for the owner of publicKey.
+func (s *Main) sealMessage(msg protocol.Message, publicKey string) (protocol.Message, error) {
+	encrypted, err := e2e.Encrypt(msg.Message, publicKey, s.localUser.PrivateKey)
+	if err != nil {
+		return msg, err
+	}
+
+	msg.Message = encrypted
+
+	if msg.Attachment != "" {
+		msg.Attachment, err = e2e.Encrypt(msg.Attachment, publicKey, s.localUser.PrivateKey)
+		if err != nil {
+			return msg, err
+		}
+	}
+
+	return msg, nil
+}
+
+func toWireMessage(message data.Message) protocol.Message {
+	return protocol.Message{
+		ID:          message.ID,
+		Sender:      message.Sender,
+		Receiver:    message.Receiver,
+		Message:     message.Message,
+		DateCreated: message.DateCrated,
+	}
+}
+
+func fromWireMessage(message protocol.Message) data.Message {
+	return data.Message{
+		ID:         message.ID,
+		Sender:     message.Sender,
+		Receiver:   message.Receiver,
+		Message:    message.Message,
+		DateCrated: message.DateCreated,
+	}
+}
+
+// addErrorMessage shows an error in the chat, message is escaped since it often contains names or
+// errors from the server.
 func (s *Main) addErrorMessage(message string) {
-	fmt.Fprintf(s.internalTextView, "[#ffffff]Error: [#ff0000]%s\n", message)
+	fmt.Fprintf(s.internalTextView, "%sError: %s%s\n", s.theme.Text.Tag(), s.theme.Error.Tag(), tview.Escape(message))
 }
 
-func (s *Main) addSuccessMessage(message string) {
-	fmt.Fprintf(s.internalTextView, "[#ffffff]Success:[#00ff00] %s\n", message)
+// addNoticeMessage shows a notice in the chat, message is escaped like in addErrorMessage.
+func (s *Main) addNoticeMessage(message string) {
+	fmt.Fprintf(s.internalTextView, "%s%s\n", s.theme.Muted.Tag(), tview.Escape(message))
 }
 
-func (s *Main) addMessage(message data.Message) {
-	fmt.Fprintf(s.internalTextView, "[#ffffff]%s: %s\n", message.Sender, message.Message)
+func (s *Main) addMessage(message data.Message, sender string) {
+	var status string
+	if message.Sender == s.localUser.SellyID {
+		status = " " + s.statusTicks(message.Status)
+	}
+
+	// messages shown as they arrive aren't read from the database and can't be searched for
+	regionID, region, endRegion := "", "", ""
+	if message.RowID != 0 {
+		regionID = messageRegion(message.RowID)
+		region, endRegion = fmt.Sprintf(`["%s"]`, regionID), `[""]`
+	}
+
+	// names and messages come from other users, they're escaped so they can't add colors or regions to the chat
+	sender = tview.Escape(sender)
+
+	body := s.formatMessage(message.Message, regionID)
+	if message.Attachment != nil {
+		body = s.attachmentText(*message.Attachment)
+	}
+
+	text, name := s.theme.Text.Tag(), s.theme.Name(message.Sender).Tag()
+
+	line := fmt.Sprintf("%s%s%s: %s", name, sender, text, body)
+	if action := strings.TrimPrefix(message.Message, "/me "); message.Attachment == nil && action != message.Message {
+		line = fmt.Sprintf("* %s%s%s %s", name, sender, text, s.formatMessage(action, regionID))
+	}
+
+	// messages stored before timestamps were recorded have none
+	if message.DateCrated == 0 {
+		line = strings.ReplaceAll(line, "\n", "\n  ")
+		fmt.Fprintf(s.internalTextView, "%s%s%s%s%s\n", region, text, line, status, endRegion)
+		return
+	}
+
+	date := time.Unix(message.DateCrated, 0).Local()
+	timestamp := date.Format(s.cfg.TimeFormat)
+
+	// the lines of multi-line messages start below the sender's name
+	line = strings.ReplaceAll(line, "\n", "\n"+strings.Repeat(" ", runewidth.StringWidth(timestamp)+1))
+
+	if !isSameDay(date, s.lastMessageDate) {
+		fmt.Fprintf(s.internalTextView, "%s── %s ──\n", s.theme.Muted.Tag(), dayLabel(date, time.Now()))
+		s.lastMessageDate = date
+	}
+
+	fmt.Fprintf(s.internalTextView, "%s%s%s %s%s%s%s\n", region, s.theme.Muted.Tag(), tview.Escape(timestamp), text, line, status, endRegion)
+}
+
+func (s *Main) statusTicks(status int) string {
+	muted := s.theme.Muted.Tag()
+
+	switch status {
+	case data.StatusDelivered:
+		return muted + "✓✓"
+	case data.StatusRead:
+		return s.theme.Accent.Tag() + "✓✓"
+	case data.StatusPending:
+		return muted + "○"
+	case data.StatusFailed:
+		return s.theme.Error.Tag() + "✗ not sent"
+	}
+
+	return muted + "✓"
 }
 
 func (s *Main) Render() tview.Primitive {
-	return tview.NewFlex().
-		AddItem(s.friendsList.GetTreeView(), 0, 1, false).
-		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
-			AddItem(s.internalTextView, 0, 8, false).
-			AddItem(s.messageInput, 3, 1, false).
-			AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
-				AddItem(s.addFriendBtn, 0, 1, false).
-				AddItem(s.deleteFriendBtn, 0, 1, false).
-				AddItem(s.editFriendBtn, 0, 1, false).
-				AddItem(s.myDetailsButton, 0, 1, false), 0, 1, false), 0, 2, false)
+	// the message input grows with the message, the chat above it shrinks
+	s.chatColumn = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(s.internalTextView, 0, 8, false).
+		AddItem(s.messageInput, s.messageInput.Lines()+2, 0, true).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
+			AddItem(s.addFriendBtn, 0, 1, false).
+			AddItem(s.deleteFriendBtn, 0, 1, false).
+			AddItem(s.editFriendBtn, 0, 1, false).
+			AddItem(s.groupsBtn, 0, 1, false).
+			AddItem(s.attachBtn, 0, 1, false).
+			AddItem(s.myDetailsButton, 0, 1, false), 0, 1, false)
+
+	s.layout = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(tview.NewFlex().
+			AddItem(s.friendsList.GetTreeView(), 0, 1, false).
+			AddItem(s.chatColumn, 0, 2, false), 0, 1, false).
+		AddItem(s.statusBar.view, 1, 0, false)
+
+	s.layout.SetInputCapture(s.onKey)
+
+	// the main screen is shown again, e.g. after the settings or the lock screen
+	s.app.QueueUpdate(s.markSelectedAsRead)
+
+	return s.layout
 }
@@ -0,0 +1,132 @@
+package screens
+
+import (
+	"fmt"
+	"github.com/XiovV/selly-client/config"
+	"github.com/rivo/tview"
+)
+
+type ProfilePicker struct {
+	app      *tview.Application
+	profiles []config.Profile
+	list     *tview.List
+	onSelect func(profile config.Profile) error
+	onCancel func()
+}
+
+// NewProfilePicker creates a screen listing every profile. onCancel may be nil, in which case the
+// picker can't be dismissed without choosing a profile.
+func NewProfilePicker(app *tview.Application, profiles []config.Profile, onSelect func(profile config.Profile) error, onCancel func()) *ProfilePicker {
+	return &ProfilePicker{
+		app:      app,
+		profiles: profiles,
+		list:     tview.NewList(),
+		onSelect: onSelect,
+		onCancel: onCancel,
+	}
+}
+
+func (p *ProfilePicker) selectProfile(profile config.Profile) {
+	if err := p.onSelect(profile); err != nil {
+		p.showError(fmt.Sprintf("Couldn't open profile %s: %s", profile.Name, err))
+	}
+}
+
+func (p *ProfilePicker) showError(message string) {
+	modal := tview.NewModal().
+		SetText(message).
+		AddButtons([]string{"Okay"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			p.app.SetRoot(p.Render(), true)
+		})
+
+	p.app.SetRoot(modal, true)
+}
+
+func (p *ProfilePicker) showCreateProfileForm() {
+	form := tview.NewForm().
+		AddInputField("Name", "", 0, nil, nil).
+		AddInputField("Server", "", 0, nil, nil)
+
+	nameInput := form.GetFormItem(0).(*tview.InputField)
+	serverInput := form.GetFormItem(1).(*tview.InputField)
+	serverInput.SetPlaceholder("leave empty to use the default server")
+
+	form.AddButton("Create", func() {
+		if err := config.ValidateProfileName(nameInput.GetText()); err != nil {
+			nameInput.SetText("")
+			nameInput.SetPlaceholder(err.Error())
+			return
+		}
+
+		for _, profile := range p.profiles {
+			if profile.Name == nameInput.GetText() {
+				nameInput.SetText("")
+				nameInput.SetPlaceholder("a profile with this name already exists")
+				return
+			}
+		}
+
+		var profileConfig *config.Config
+
+		if serverInput.GetText() != "" {
+			profileConfig = config.Default()
+
+			if err := profileConfig.SetServer(serverInput.GetText()); err != nil {
+				serverInput.SetText("")
+				serverInput.SetPlaceholder(err.Error())
+				return
+			}
+		}
+
+		profile, err := config.OpenProfile(nameInput.GetText())
+		if err != nil {
+			p.showError(fmt.Sprintf("Couldn't create profile: %s", err))
+			return
+		}
+
+		if profileConfig != nil {
+			serverConfig := config.Config{
+				APIURL:       profileConfig.APIURL,
+				WebsocketURL: profileConfig.WebsocketURL,
+				HealthURL:    profileConfig.HealthURL,
+			}
+
+			if err := profile.SaveConfig(serverConfig); err != nil {
+				p.showError(fmt.Sprintf("Couldn't save profile config: %s", err))
+				return
+			}
+		}
+
+		p.selectProfile(profile)
+	})
+
+	form.AddButton("Cancel", func() {
+		p.app.SetRoot(p.Render(), true)
+	})
+
+	form.SetBorder(true).SetTitle("New Profile").SetTitleAlign(tview.AlignLeft)
+	p.app.SetRoot(form, true)
+}
+
+func (p *ProfilePicker) Render() tview.Primitive {
+	p.list.Clear()
+
+	for _, profile := range p.profiles {
+		profile := profile
+
+		p.list.AddItem(profile.Name, profile.Dir, 0, func() {
+			p.selectProfile(profile)
+		})
+	}
+
+	p.list.AddItem("New Profile", "create a new profile with its own account", 'n', p.showCreateProfileForm)
+
+	if p.onCancel != nil {
+		p.list.AddItem("Back", "", 'b', p.onCancel)
+	}
+
+	p.list.SetBorder(true).SetTitle("Profiles").SetTitleAlign(tview.AlignLeft)
+
+	return p.list
+}
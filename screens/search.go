@@ -0,0 +1,256 @@
+package screens
+
+import (
+	"fmt"
+	"github.com/XiovV/selly-client/data"
+	"github.com/XiovV/selly-client/theme"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	searchLimit = 100
+
+	// searchDelay is how long typing has to pause before the query is searched, without the index every
+	// search decrypts and scans the messages.
+	searchDelay = 250 * time.Millisecond
+
+	// snippetContext is roughly how much of a message is shown before its first match.
+	snippetContext = 20
+)
+
+// showSearchScreen shows the search screen with query already filled in.
+func (s *Main) showSearchScreen(query string) {
+	queryInput := tview.NewInputField().SetLabel("Search: ")
+	allChats := tview.NewCheckbox().SetLabel("All chats: ").SetChecked(s.conversationID() == "")
+	statusView := tview.NewTextView().SetTextColor(s.theme.Muted.Color())
+
+	results := tview.NewList()
+	results.SetBorder(true)
+
+	// searchTimer runs the search once the user stops typing, it's only touched on the UI goroutine
+	var searchTimer *time.Timer
+
+	back := func() {
+		if searchTimer != nil {
+			searchTimer.Stop()
+		}
+
+		s.app.SetRoot(s.Render(), true)
+	}
+
+	search := func() {
+		sellyId := s.conversationID()
+		if allChats.IsChecked() {
+			sellyId = ""
+		}
+
+		found, err := s.db.SearchMessages(queryInput.GetText(), sellyId, searchLimit)
+		if err != nil {
+			found = nil
+		}
+
+		s.showSearchResults(results, found, data.SearchTerms(queryInput.GetText()))
+
+		statusView.SetTextColor(s.theme.Muted.Color())
+
+		switch {
+		case err != nil:
+			statusView.SetTextColor(s.theme.Error.Color()).SetText(fmt.Sprintf("couldn't search messages: %s", err))
+		case len(data.SearchTerms(queryInput.GetText())) == 0:
+			statusView.SetText("")
+		case len(found) == 0:
+			statusView.SetText("No messages found")
+		case len(found) == searchLimit:
+			statusView.SetText(fmt.Sprintf("Showing the newest %d results", searchLimit))
+		default:
+			statusView.SetText(fmt.Sprintf("%d results", len(found)))
+		}
+	}
+
+	queryInput.SetChangedFunc(func(string) {
+		if searchTimer != nil {
+			searchTimer.Stop()
+		}
+
+		searchTimer = time.AfterFunc(searchDelay, func() {
+			s.app.QueueUpdateDraw(search)
+		})
+	})
+	allChats.SetChangedFunc(func(bool) { search() })
+
+	focusables := []tview.Primitive{queryInput, allChats, results}
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(queryInput, 1, 0, true).
+		AddItem(allChats, 1, 0, false).
+		AddItem(statusView, 1, 0, false).
+		AddItem(results, 0, 1, false)
+
+	layout.SetBorder(true).SetTitle("Search messages (Tab to switch, Esc to go back)").SetTitleAlign(tview.AlignLeft)
+
+	layout.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			back()
+			return nil
+		case tcell.KeyTab, tcell.KeyBacktab:
+			step := 1
+			if event.Key() == tcell.KeyBacktab {
+				step = len(focusables) - 1
+			}
+
+			for i, p := range focusables {
+				if p.HasFocus() {
+					s.app.SetFocus(focusables[(i+step)%len(focusables)])
+					break
+				}
+			}
+
+			return nil
+		}
+
+		return event
+	})
+
+	queryInput.SetDoneFunc(func(key tcell.Key) {
+		if key != tcell.KeyEnter {
+			return
+		}
+
+		// Enter doesn't wait for the user to stop typing
+		if searchTimer != nil && searchTimer.Stop() {
+			search()
+		}
+
+		if results.GetItemCount() > 0 {
+			s.app.SetFocus(results)
+		}
+	})
+
+	queryInput.SetText(query)
+
+	s.app.SetRoot(layout, true)
+}
+
+func (s *Main) showSearchResults(list *tview.List, results []data.SearchResult, terms []string) {
+	list.Clear()
+
+	// results are often from the same few conversations and senders
+	names := map[string]string{}
+	senders := map[string]string{}
+
+	for _, result := range results {
+		result := result
+
+		name, ok := names[result.SellyID]
+		if !ok {
+			name = s.conversationName(result.SellyID)
+			names[result.SellyID] = name
+		}
+
+		sender, ok := senders[result.Sender]
+		if !ok {
+			sender = s.senderName(result.Sender)
+			senders[result.Sender] = sender
+		}
+
+		title := tview.Escape(name)
+		if result.DateCrated != 0 {
+			date := time.Unix(result.DateCrated, 0).Local()
+			title += " · " + lastSeenLabel(date, time.Now(), s.cfg.TimeFormat)
+		}
+
+		text := fmt.Sprintf("%s: %s", tview.Escape(sender), highlightTerms(snippet(result.Message, terms), terms, s.theme.Highlight))
+
+		list.AddItem(title, text, 0, func() {
+			s.jumpToMessage(result)
+		})
+	}
+}
+
+// jumpToMessage opens the conversation a search result belongs to and scrolls to the message.
+func (s *Main) jumpToMessage(result data.SearchResult) {
+	s.app.SetRoot(s.Render(), true)
+
+	node := s.friendsList.FindConversation(result.SellyID)
+	if node == nil {
+		return
+	}
+
+	s.friendsList.SetCurrentFriend(node)
+	s.onFriendSelect(node)
+	s.loadMessagesFrom(result.RowID)
+
+	s.internalTextView.Highlight(messageRegion(result.RowID)).ScrollToHighlight()
+}
+
+// conversationName returns the name of a friend or a group.
+func (s *Main) conversationName(id string) string {
+	if group, err := s.db.GetGroup(id); err == nil {
+		return group.Name
+	}
+
+	return s.senderName(id)
+}
+
+// messageRegion returns the ID of the region a message is written into in the chat, so it can be highlighted.
+func messageRegion(rowId int64) string {
+	return strconv.FormatInt(rowId, 10)
+}
+
+// termsPattern matches any of the terms, ignoring case.
+func termsPattern(terms []string) *regexp.Regexp {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+
+	return regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+}
+
+// snippet cuts off the beginning of a long message so its first match is visible in the results.
+func snippet(text string, terms []string) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	if len(terms) == 0 {
+		return text
+	}
+
+	match := termsPattern(terms).FindStringIndex(text)
+	if match == nil || match[0] <= snippetContext {
+		return text
+	}
+
+	start := match[0] - snippetContext
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+
+	return "…" + text[start:]
+}
+
+// highlightTerms escapes text for a tview primitive with dynamic colors and highlights the terms in it with style.
+func highlightTerms(text string, terms []string, style theme.Style) string {
+	if len(terms) == 0 {
+		return tview.Escape(text)
+	}
+
+	var b strings.Builder
+	last := 0
+
+	for _, match := range termsPattern(terms).FindAllStringIndex(text, -1) {
+		b.WriteString(tview.Escape(text[last:match[0]]))
+		b.WriteString(style.Tag() + tview.Escape(text[match[0]:match[1]]) + "[-:-:-]")
+		last = match[1]
+	}
+
+	b.WriteString(tview.Escape(text[last:]))
+
+	return b.String()
+}
@@ -1,17 +1,14 @@
 package screens
 
 import (
-	"crypto/sha256"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"github.com/XiovV/selly-client/config"
 	"github.com/XiovV/selly-client/data"
+	"github.com/XiovV/selly-client/seed"
+	"github.com/XiovV/selly-client/theme"
 	"github.com/rivo/tview"
 	"io/ioutil"
-	"strings"
-)
-
-const (
-	seedLength = 5
 )
 
 type Startup struct {
@@ -19,16 +16,22 @@ type Startup struct {
 	pages                 *tview.Pages
 	generateAccountScreen *GenerateAccount
 	db                    *data.Repository
+	cfg                   *config.Config
+	theme                 *theme.Theme
+	onAccountReady        func()
 }
 
-func NewStartupScreen(app *tview.Application, db *data.Repository) *Startup {
+func NewStartupScreen(app *tview.Application, db *data.Repository, cfg *config.Config, theme *theme.Theme, onAccountReady func()) *Startup {
 	pages := tview.NewPages()
 
 	return &Startup{
 		app:                   app,
 		pages:                 pages,
-		generateAccountScreen: NewGenerateAccountScreen(app, db),
+		generateAccountScreen: NewGenerateAccountScreen(app, db, cfg, onAccountReady),
 		db:                    db,
+		cfg:                   cfg,
+		theme:                 theme,
+		onAccountReady:        onAccountReady,
 	}
 }
 
@@ -59,26 +62,15 @@ func (s *Startup) showImportFromFileForm() {
 			return
 		}
 
-		containsComma := strings.Contains(acc.Seed, ", ")
-
-		if !containsComma {
-			pathInput.SetText("")
-			pathInput.SetPlaceholder("words must be comma separated")
-			return
-		}
-
-		seed := strings.Split(acc.Seed, ", ")
-
-		if len(seed) != seedLength && containsComma {
+		words, err := s.parseSeed(acc.Seed)
+		if err != nil {
 			pathInput.SetText("")
-			pathInput.SetPlaceholder(fmt.Sprintf("the seed must be %d words, got: %d", seedLength, len(seed)))
+			pathInput.SetPlaceholder(err.Error())
 			return
 		}
 
-		id := s.generateIDFromSeed(seed)
-
-		s.db.StoreLocalUserInfo(id, acc.Seed)
-		s.app.SetRoot(NewMainScreen(s.app, s.db).Render(), true)
+		s.db.StoreLocalUserInfo(seed.SellyID(words), seed.String(words))
+		s.onAccountReady()
 	})
 
 	form.AddButton("Cancel", func() {
@@ -93,50 +85,46 @@ func (s *Startup) showManualAccountRestoreForm() {
 		AddInputField("Seed:", "", 0, nil, nil)
 
 	seedInput := form.GetFormItem(0).(*tview.InputField)
-	seedInput.SetPlaceholder("enter your seed, words must be comma separated")
-
-	form.AddButton("Restore", func() {
-		if seedInput.GetText() == "" {
-			seedInput.SetText("")
-			seedInput.SetPlaceholder("input must not be empty")
-			return
-		}
+	seedInput.SetPlaceholder("enter your seed, words separated by commas or spaces")
 
-		containsComma := strings.Contains(seedInput.GetText(), ", ")
+	// the seed is kept in the input so mistyped words can be corrected, errors are shown below it instead
+	errorView := tview.NewTextView()
+	errorView.SetTextColor(s.theme.Error.Color())
 
-		if !containsComma {
-			seedInput.SetText("")
-			seedInput.SetPlaceholder("words must be comma separated")
-			return
-		}
-
-		seed := strings.Split(seedInput.GetText(), ", ")
-
-		if len(seed) != seedLength && containsComma {
-			seedInput.SetText("")
-			seedInput.SetPlaceholder(fmt.Sprintf("the seed must be %d words, got: %d", seedLength, len(seed)))
+	form.AddButton("Restore", func() {
+		words, err := s.parseSeed(seedInput.GetText())
+		if err != nil {
+			errorView.SetText(err.Error())
 			return
 		}
 
-		id := s.generateIDFromSeed(seed)
-
-		s.db.StoreLocalUserInfo(id, seedInput.GetText())
-		s.app.SetRoot(NewMainScreen(s.app, s.db).Render(), true)
+		s.db.StoreLocalUserInfo(seed.SellyID(words), seed.String(words))
+		s.onAccountReady()
 	})
 
 	form.AddButton("Cancel", func() {
 		s.app.SetRoot(s.Render(), true)
 	})
 
-	s.app.SetRoot(form, true)
+	s.app.SetRoot(tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(form, 0, 1, true).
+		AddItem(errorView, 2, 0, false), true)
 }
 
-func (s *Startup) generateIDFromSeed(seed []string) string {
-	hashedSeed := sha256.Sum256([]byte(strings.Join(seed, "")))
+// parseSeed splits the seed into words and validates them. Mistyped words are reported along with
+// the closest matches from the word list.
+func (s *Startup) parseSeed(text string) ([]string, error) {
+	words := seed.Parse(text)
 
-	sellyId := sha256.Sum256([]byte(fmt.Sprintf("%x", hashedSeed[:])))
+	if len(words) == 0 {
+		return nil, errors.New("input must not be empty")
+	}
+
+	if err := seed.Validate(words); err != nil {
+		return nil, err
+	}
 
-	return fmt.Sprintf("%x", sellyId[:])
+	return words, nil
 }
 
 func (s *Startup) showRestoreAccountModal() {
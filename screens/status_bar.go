@@ -0,0 +1,70 @@
+package screens
+
+import (
+	"fmt"
+	"github.com/XiovV/selly-client/theme"
+	"github.com/XiovV/selly-client/ws"
+	"github.com/rivo/tview"
+	"sync"
+	"time"
+)
+
+// statusBar shows the state of the connection to the server along with the number of messages
+// waiting in the outbox.
+type statusBar struct {
+	view   *tview.TextView
+	server string
+	theme  *theme.Theme
+
+	mu       sync.Mutex
+	transfer string
+}
+
+func newStatusBar(server string, theme *theme.Theme) *statusBar {
+	view := tview.NewTextView().SetDynamicColors(true)
+
+	return &statusBar{view: view, server: server, theme: theme}
+}
+
+// setTransfer sets the progress of the current upload or download, an empty string hides it.
+func (b *statusBar) setTransfer(transfer string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.transfer = transfer
+}
+
+func (b *statusBar) update(event ws.Event, outboxSize int) {
+	var state string
+	t := b.theme
+
+	switch event.State {
+	case ws.Connected:
+		state = t.Success.Tag() + "● connected"
+	case ws.Connecting:
+		state = t.Warning.Tag() + "● connecting…"
+	case ws.Reconnecting:
+		retryIn := time.Until(event.NextRetry).Round(time.Second)
+		if retryIn < 0 {
+			retryIn = 0
+		}
+
+		state = fmt.Sprintf("%s● offline%s, reconnecting in %s", t.Error.Tag(), t.Text.Tag(), retryIn)
+	default:
+		state = t.Error.Tag() + "● offline"
+	}
+
+	text := fmt.Sprintf("%s%s · %s", state, t.Muted.Tag(), b.server)
+
+	if outboxSize > 0 {
+		text += fmt.Sprintf(" · %s%d message(s) waiting to be sent", t.Warning.Tag(), outboxSize)
+	}
+
+	b.mu.Lock()
+	if b.transfer != "" {
+		text += " · " + t.Text.Tag() + tview.Escape(b.transfer)
+	}
+	b.mu.Unlock()
+
+	b.view.SetText(text)
+}
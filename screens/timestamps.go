@@ -0,0 +1,47 @@
+package screens
+
+import (
+	"fmt"
+	"time"
+)
+
+// normalizeTimestamp converts a timestamp received from the server to Unix seconds. Missing timestamps
+// are replaced with the current time and timestamps in milliseconds are converted to seconds.
+func normalizeTimestamp(timestamp int64) int64 {
+	if timestamp <= 0 {
+		return time.Now().Unix()
+	}
+
+	// a timestamp in seconds won't reach 1e12 until the year 33658
+	if timestamp >= 1e12 {
+		return timestamp / 1000
+	}
+
+	return timestamp
+}
+
+// dayLabel returns the text of the separator shown above the first message of a day.
+func dayLabel(t, now time.Time) string {
+	switch {
+	case isSameDay(t, now):
+		return "Today"
+	case isSameDay(t, now.AddDate(0, 0, -1)):
+		return "Yesterday"
+	case t.Year() == now.Year():
+		return t.Format("Monday, 2 January")
+	}
+
+	return t.Format("Monday, 2 January 2006")
+}
+
+func isSameDay(a, b time.Time) bool {
+	aYear, aMonth, aDay := a.Date()
+	bYear, bMonth, bDay := b.Date()
+
+	return aYear == bYear && aMonth == bMonth && aDay == bDay
+}
+
+// lastSeenLabel describes when a friend was last online, e.g. "Yesterday at 15:04".
+func lastSeenLabel(t, now time.Time, layout string) string {
+	return fmt.Sprintf("%s at %s", dayLabel(t, now), t.Format(layout))
+}
@@ -0,0 +1,66 @@
+package screens
+
+import (
+	"errors"
+	"github.com/XiovV/selly-client/data"
+	"github.com/XiovV/selly-client/ws"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// newTokenTestMain returns a screen of a local user without a token, whose tokens are requested from a
+// server calling handle first.
+func newTokenTestMain(t *testing.T, handle func(s *Main)) *Main {
+	t.Helper()
+
+	s := newTestMain()
+	s.db = data.NewRepository(filepath.Join(t.TempDir(), "selly.db"))
+	s.localUser.Seed = "seed"
+	s.ws = ws.NewManager("", s.getToken)
+	s.typing = newTypingNotifier(func(string, bool) {}, func(f func()) { f() })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle(s)
+		w.Write([]byte(`{"access_token": "token"}`))
+	}))
+
+	s.cfg.APIURL = server.URL
+
+	t.Cleanup(func() {
+		server.Close()
+		s.db.Close()
+	})
+
+	return s
+}
+
+func TestGetToken(t *testing.T) {
+	s := newTokenTestMain(t, func(*Main) {})
+
+	token, err := s.getToken()
+	if err != nil || token != "token" {
+		t.Fatalf("got %q (%v), want token", token, err)
+	}
+
+	if s.localUser.JWT != "token" {
+		t.Errorf("got stored token %q, want token", s.localUser.JWT)
+	}
+}
+
+func TestGetTokenWhilePausing(t *testing.T) {
+	s := newTokenTestMain(t, (*Main).Pause)
+
+	if token, err := s.getToken(); !errors.Is(err, errPaused) {
+		t.Fatalf("got %q (%v), want %v", token, err, errPaused)
+	}
+
+	if s.localUser.JWT != "" {
+		t.Errorf("the token %q was kept after pausing", s.localUser.JWT)
+	}
+
+	if token, err := s.getToken(); !errors.Is(err, errPaused) {
+		t.Errorf("got %q (%v) while paused, want %v", token, err, errPaused)
+	}
+}
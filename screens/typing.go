@@ -0,0 +1,91 @@
+package screens
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// typingInterval is how often a typing payload is repeated while the user keeps typing.
+	typingInterval = 3 * time.Second
+	// typingTimeout is how long the user has to stop typing before they're reported as having stopped.
+	typingTimeout = 5 * time.Second
+	// typingExpiry is how long a friend is shown as typing without hearing from them again,
+	// in case their "stopped typing" payload got lost.
+	typingExpiry = 2 * typingTimeout
+)
+
+// typingNotifier throttles the typing payloads sent while the user is composing a message.
+// The timeout runs through queue, so send is always called on the same goroutine as typed and stop.
+type typingNotifier struct {
+	mu        sync.Mutex
+	send      func(receiver string, typing bool)
+	queue     func(func())
+	receiver  string
+	lastSent  time.Time
+	stopTimer *time.Timer
+	timeouts  int
+}
+
+func newTypingNotifier(send func(receiver string, typing bool), queue func(func())) *typingNotifier {
+	return &typingNotifier{send: send, queue: queue}
+}
+
+// typed is called whenever the user changes the message addressed to receiver.
+func (t *typingNotifier) typed(receiver string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.receiver != receiver {
+		t.stopLocked()
+		t.receiver = receiver
+	}
+
+	if time.Since(t.lastSent) >= typingInterval {
+		t.send(receiver, true)
+		t.lastSent = time.Now()
+	}
+
+	if t.stopTimer != nil {
+		t.stopTimer.Stop()
+	}
+
+	// a timeout that's already queued when the user types again is ignored
+	t.timeouts++
+	timeout := t.timeouts
+
+	t.stopTimer = time.AfterFunc(typingTimeout, func() {
+		t.queue(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			if t.timeouts == timeout {
+				t.stopLocked()
+			}
+		})
+	})
+}
+
+// stop reports that the user stopped typing, unless they weren't typing to begin with.
+func (t *typingNotifier) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stopLocked()
+}
+
+func (t *typingNotifier) stopLocked() {
+	if t.stopTimer != nil {
+		t.stopTimer.Stop()
+		t.stopTimer = nil
+	}
+
+	if t.receiver == "" {
+		return
+	}
+
+	t.send(t.receiver, false)
+
+	t.receiver = ""
+	t.lastSent = time.Time{}
+}
@@ -1,13 +1,8 @@
 package screens
 
-import (
-	"github.com/rivo/tview"
-	"strings"
-)
-
-func validateUsernameInput(usernameField *tview.InputField) (bool, string) {
-	username := usernameField.GetText()
+import "strings"
 
+func validateUsername(username string) (bool, string) {
 	if len(username) < 1 {
 		return false, "username must be at least 1 character long"
 	}
@@ -23,9 +18,7 @@ func validateUsernameInput(usernameField *tview.InputField) (bool, string) {
 	return true, ""
 }
 
-func validateSellyID(sellyIDField *tview.InputField) (bool, string) {
-	sellyID := sellyIDField.GetText()
-
+func validateSellyIDText(sellyID string) (bool, string) {
 	if len(sellyID) != 64 {
 		return false, "Selly ID must be exactly 64 characters long"
 	}
@@ -0,0 +1,230 @@
+package seed
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+const (
+	DefaultLength = 12
+	bitsPerWord   = 11
+	legacyLength  = 5
+)
+
+// legacyWords were used to generate seeds before the BIP39 word list was introduced,
+// accounts created back then can still be restored.
+var legacyWords = map[string]bool{
+	"apple": true, "banana": true, "car": true, "orange": true, "book": true, "monitor": true, "computer": true,
+	"poster": true, "box": true, "fan": true, "card": true, "desk": true, "table": true,
+}
+
+// UnknownWordError is returned by Validate when a word isn't on the word list.
+type UnknownWordError struct {
+	Word        string
+	Suggestions []string
+}
+
+func (e *UnknownWordError) Error() string {
+	if len(e.Suggestions) == 0 {
+		return fmt.Sprintf("unknown word %q", e.Word)
+	}
+
+	return fmt.Sprintf("unknown word %q, did you mean: %s?", e.Word, strings.Join(e.Suggestions, ", "))
+}
+
+// ValidLength reports whether a seed of n words can be generated, as in BIP39 this is 12, 15, 18, 21 or 24 words.
+func ValidLength(n int) bool {
+	return n >= 12 && n <= 24 && n%3 == 0
+}
+
+// Generate returns a new seed of the given number of words, picked with crypto/rand.
+// The last word carries a checksum of the others, see Validate.
+func Generate(length int) ([]string, error) {
+	if !ValidLength(length) {
+		return nil, fmt.Errorf("the seed must be 12, 15, 18, 21 or 24 words, got: %d", length)
+	}
+
+	entropy := make([]byte, entropyBits(length)/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return nil, err
+	}
+
+	return fromEntropy(entropy), nil
+}
+
+// fromEntropy turns entropy of 128 to 256 bits into words, followed by the checksum.
+func fromEntropy(entropy []byte) []string {
+	length := len(entropy) * 8 * 33 / 32 / bitsPerWord
+
+	bits := new(big.Int).SetBytes(entropy)
+	bits.Lsh(bits, uint(checksumBits(length)))
+	bits.Or(bits, big.NewInt(int64(checksum(entropy, length))))
+
+	words := make([]string, length)
+	mask := big.NewInt(1<<bitsPerWord - 1)
+
+	for i := length - 1; i >= 0; i-- {
+		index := new(big.Int).And(bits, mask).Int64()
+		words[i] = wordlist[index]
+		bits.Rsh(bits, bitsPerWord)
+	}
+
+	return words
+}
+
+// Validate checks that every word is on the word list and that the checksum matches.
+// Legacy 5 word seeds have no checksum and are only checked against the legacy word list.
+func Validate(words []string) error {
+	if len(words) == legacyLength && isLegacy(words) {
+		return nil
+	}
+
+	if !ValidLength(len(words)) {
+		return fmt.Errorf("the seed must be 12, 15, 18, 21 or 24 words, got: %d", len(words))
+	}
+
+	bits := new(big.Int)
+
+	for _, word := range words {
+		index, ok := wordIndex[word]
+		if !ok {
+			return &UnknownWordError{Word: word, Suggestions: Suggest(word)}
+		}
+
+		bits.Lsh(bits, bitsPerWord)
+		bits.Or(bits, big.NewInt(int64(index)))
+	}
+
+	cs := checksumBits(len(words))
+	expected := new(big.Int).And(bits, big.NewInt(1<<cs-1)).Int64()
+	bits.Rsh(bits, uint(cs))
+
+	entropy := make([]byte, entropyBits(len(words))/8)
+	bits.FillBytes(entropy)
+
+	if int64(checksum(entropy, len(words))) != expected {
+		return fmt.Errorf("invalid seed, check the spelling and order of the words")
+	}
+
+	return nil
+}
+
+// Parse splits a seed into words, accepting commas and/or whitespace between them.
+func Parse(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// String formats words the way seeds are stored and exported.
+func String(words []string) string {
+	return strings.Join(words, ", ")
+}
+
+// SellyID derives the SellyID belonging to a seed.
+func SellyID(words []string) string {
+	hashedSeed := sha256.Sum256([]byte(strings.Join(words, "")))
+
+	sellyId := sha256.Sum256([]byte(fmt.Sprintf("%x", hashedSeed[:])))
+
+	return fmt.Sprintf("%x", sellyId[:])
+}
+
+// Suggest returns up to 3 words from the word list that are closest to word.
+func Suggest(word string) []string {
+	type candidate struct {
+		word     string
+		distance int
+	}
+
+	candidates := []candidate{}
+
+	for _, w := range wordlist {
+		// the first 4 letters uniquely identify a BIP39 word
+		if len(word) >= 4 && strings.HasPrefix(w, word[:4]) {
+			candidates = append(candidates, candidate{w, 0})
+			continue
+		}
+
+		if d := levenshtein(word, w); d <= 2 {
+			candidates = append(candidates, candidate{w, d})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	suggestions := []string{}
+	for i := 0; i < len(candidates) && i < 3; i++ {
+		suggestions = append(suggestions, candidates[i].word)
+	}
+
+	return suggestions
+}
+
+func isLegacy(words []string) bool {
+	for _, word := range words {
+		if !legacyWords[word] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func entropyBits(length int) int {
+	return length * bitsPerWord * 32 / 33
+}
+
+func checksumBits(length int) int {
+	return entropyBits(length) / 32
+}
+
+func checksum(entropy []byte, length int) int {
+	hash := sha256.Sum256(entropy)
+
+	return int(hash[0]) >> (8 - checksumBits(length))
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+
+	return m
+}
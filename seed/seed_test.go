@@ -0,0 +1,124 @@
+package seed
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// vectors are from the BIP39 reference implementation.
+var vectors = []struct {
+	entropy string
+	words   string
+}{
+	{"00000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"},
+	{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f", "legal winner thank year wave sausage worth useful legal winner thank yellow"},
+	{"80808080808080808080808080808080", "letter advice cage absurd amount doctor acoustic avoid letter advice cage above"},
+	{"ffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong"},
+	{"000000000000000000000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon agent"},
+	{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f", "legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth useful legal will"},
+	{"ffffffffffffffffffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo when"},
+	{"0000000000000000000000000000000000000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art"},
+	{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f", "legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth title"},
+	{"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote"},
+	{"9e885d952ad362caeb4efe34a8e91bd2", "ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic"},
+}
+
+func TestWordlist(t *testing.T) {
+	if len(wordlist) != 1<<bitsPerWord {
+		t.Fatalf("got %d words, want %d", len(wordlist), 1<<bitsPerWord)
+	}
+
+	for i, word := range wordlist {
+		if index, ok := wordIndex[word]; !ok || index != i {
+			t.Errorf("%q is at %d, but indexed at %d", word, i, index)
+		}
+	}
+}
+
+func TestVectors(t *testing.T) {
+	for _, tt := range vectors {
+		entropy, err := hex.DecodeString(tt.entropy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if words := strings.Join(fromEntropy(entropy), " "); words != tt.words {
+			t.Errorf("got %q for %s, want %q", words, tt.entropy, tt.words)
+		}
+
+		if err := Validate(Parse(tt.words)); err != nil {
+			t.Errorf("%q: %s", tt.words, err)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	for length := 12; length <= 24; length += 3 {
+		words, err := Generate(length)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(words) != length {
+			t.Fatalf("got %d words, want %d", len(words), length)
+		}
+
+		if err := Validate(Parse(String(words))); err != nil {
+			t.Errorf("%q: %s", String(words), err)
+		}
+
+		other, err := Generate(length)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if String(words) == String(other) {
+			t.Errorf("generated %q twice", String(words))
+		}
+	}
+}
+
+func TestGenerateInvalidLength(t *testing.T) {
+	for _, length := range []int{0, 5, 11, 13, 27} {
+		if _, err := Generate(length); err == nil {
+			t.Errorf("generated a seed of %d words", length)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		words string
+		valid bool
+	}{
+		{"legacy", "apple, banana, car, orange, book", true},
+		{"wrong checksum", strings.Repeat("abandon ", 12), false},
+		{"swapped words", "legal winner thank year wave sausage worth useful legal winner yellow thank", false},
+		{"too short", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", false},
+		{"unknown word", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandom about", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(Parse(tt.words)); (err == nil) != tt.valid {
+				t.Errorf("got error %v, want valid %t", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateSuggestions(t *testing.T) {
+	err := Validate(Parse("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandom about"))
+
+	var unknownWord *UnknownWordError
+	if !errors.As(err, &unknownWord) || unknownWord.Word != "abandom" {
+		t.Fatalf("got %v, want an *UnknownWordError for abandom", err)
+	}
+
+	if len(unknownWord.Suggestions) == 0 || unknownWord.Suggestions[0] != "abandon" {
+		t.Errorf("got suggestions %v, want abandon first", unknownWord.Suggestions)
+	}
+}
@@ -0,0 +1,279 @@
+package theme
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"hash/fnv"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Names of the built-in themes.
+const (
+	Dark         = "dark"
+	Light        = "light"
+	HighContrast = "high-contrast"
+	Monochrome   = "monochrome"
+)
+
+// Style is a colour with optional attributes, written like a tview color tag without the brackets:
+// "foreground:background:attributes", e.g. "#ffffff", "red", "#ffff00::b" or "::d". Empty parts use
+// the terminal's defaults.
+type Style string
+
+// Theme holds the colours of the client.
+type Theme struct {
+	// Base is the built-in theme a theme file starts from, it defaults to dark.
+	Base string `json:"base,omitempty"`
+
+	// Background, Field, Border and Title colour the primitives themselves, only their foreground is used.
+	// Field is the background of input fields and buttons.
+	Background Style `json:"background,omitempty"`
+	Field      Style `json:"field,omitempty"`
+	Border     Style `json:"border,omitempty"`
+	Title      Style `json:"title,omitempty"`
+
+	Text      Style `json:"text,omitempty"`
+	Muted     Style `json:"muted,omitempty"`
+	Accent    Style `json:"accent,omitempty"`
+	Highlight Style `json:"highlight,omitempty"`
+	Code      Style `json:"code,omitempty"`
+	Success   Style `json:"success,omitempty"`
+	Warning   Style `json:"warning,omitempty"`
+	Error     Style `json:"error,omitempty"`
+
+	// Names are the colours friends' names are shown in, every friend always gets the same one.
+	Names []Style `json:"names,omitempty"`
+}
+
+var builtin = map[string]Theme{
+	Dark: {
+		Background: "black",
+		Field:      "blue",
+		Border:     "white",
+		Title:      "white",
+		Text:       "#ffffff",
+		Muted:      "#808080",
+		Accent:     "#00afff",
+		Highlight:  "#ffd700",
+		Code:       "#d7af87",
+		Success:    "#00ff00",
+		Warning:    "#fccb00",
+		Error:      "#ff0000",
+		Names:      []Style{"#ff5f5f", "#5fd7ff", "#afd75f", "#ffaf5f", "#d787ff", "#5fd7af", "#ff87af", "#87afff"},
+	},
+	Light: {
+		Background: "#ffffff",
+		Field:      "#d0d0d0",
+		Border:     "#5f5f5f",
+		Title:      "#000000",
+		Text:       "#000000",
+		Muted:      "#6c6c6c",
+		Accent:     "#005fd7",
+		Highlight:  "#af5f00",
+		Code:       "#875f00",
+		Success:    "#008700",
+		Warning:    "#af8700",
+		Error:      "#d70000",
+		Names:      []Style{"#af0000", "#005faf", "#5f8700", "#af5f00", "#8700af", "#008787", "#af005f", "#5f5faf"},
+	},
+	HighContrast: {
+		Background: "#000000",
+		Field:      "#000080",
+		Border:     "#ffffff",
+		Title:      "#ffff00",
+		Text:       "#ffffff",
+		Muted:      "#c0c0c0",
+		Accent:     "#00ffff",
+		Highlight:  "#ffff00::b",
+		Code:       "#00ffff",
+		Success:    "#00ff00::b",
+		Warning:    "#ffff00::b",
+		Error:      "#ff0000::b",
+		Names:      []Style{"#ff0000", "#00ffff", "#00ff00", "#ffff00", "#ff00ff", "#ffffff"},
+	},
+	// monochrome only uses attributes, it's also used when NO_COLOR is set
+	Monochrome: {
+		Title:     "::b",
+		Muted:     "::d",
+		Accent:    "::u",
+		Highlight: "::r",
+		Code:      "::r",
+		Success:   "::b",
+		Warning:   "::b",
+		Error:     "::b",
+	},
+}
+
+// Load returns the built-in theme called name, or loads it from a file. Names which aren't paths
+// are looked up as <name>.json in dir. An empty name is the dark theme.
+func Load(name, dir string) (*Theme, error) {
+	if name == "" {
+		name = Dark
+	}
+
+	if t, ok := builtin[name]; ok {
+		return &t, nil
+	}
+
+	path := name
+	if !strings.ContainsRune(name, filepath.Separator) && filepath.Ext(name) != ".json" {
+		path = filepath.Join(dir, name+".json")
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file Theme
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if file.Base == "" {
+		file.Base = Dark
+	}
+
+	base, ok := builtin[file.Base]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown base theme %q", path, file.Base)
+	}
+
+	t := base.merge(file)
+
+	if err := t.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &t, nil
+}
+
+// merge returns t with every style that's set in other replaced.
+func (t Theme) merge(other Theme) Theme {
+	for _, pair := range []struct{ style, override *Style }{
+		{&t.Background, &other.Background},
+		{&t.Field, &other.Field},
+		{&t.Border, &other.Border},
+		{&t.Title, &other.Title},
+		{&t.Text, &other.Text},
+		{&t.Muted, &other.Muted},
+		{&t.Accent, &other.Accent},
+		{&t.Highlight, &other.Highlight},
+		{&t.Code, &other.Code},
+		{&t.Success, &other.Success},
+		{&t.Warning, &other.Warning},
+		{&t.Error, &other.Error},
+	} {
+		if *pair.override != "" {
+			*pair.style = *pair.override
+		}
+	}
+
+	if len(other.Names) > 0 {
+		t.Names = other.Names
+	}
+
+	return t
+}
+
+func (t Theme) validate() error {
+	styles := append([]Style{t.Background, t.Field, t.Border, t.Title, t.Text, t.Muted, t.Accent, t.Highlight, t.Code, t.Success, t.Warning, t.Error}, t.Names...)
+
+	for _, style := range styles {
+		if err := style.validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Apply sets the colours tview uses for new primitives, it has to be called before they're created.
+func (t *Theme) Apply() {
+	tview.Styles.PrimitiveBackgroundColor = t.Background.Color()
+	tview.Styles.ContrastBackgroundColor = t.Field.Color()
+	tview.Styles.MoreContrastBackgroundColor = t.Accent.Color()
+	tview.Styles.BorderColor = t.Border.Color()
+	tview.Styles.TitleColor = t.Title.Color()
+	tview.Styles.GraphicsColor = t.Border.Color()
+	tview.Styles.PrimaryTextColor = t.Text.Color()
+	tview.Styles.SecondaryTextColor = t.Highlight.Color()
+	tview.Styles.TertiaryTextColor = t.Success.Color()
+	tview.Styles.InverseTextColor = t.Background.Color()
+	tview.Styles.ContrastSecondaryTextColor = t.Muted.Color()
+}
+
+// Name returns the style a name is shown in, sellyId decides which of the theme's name colours it gets.
+func (t *Theme) Name(sellyId string) Style {
+	if len(t.Names) == 0 {
+		return t.Text
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(sellyId))
+
+	return t.Names[h.Sum32()%uint32(len(t.Names))]
+}
+
+// Tag returns the tview color tag which switches to the style. Parts of the style that aren't set are
+// reset, except for the background which is left alone.
+func (s Style) Tag() string {
+	foreground, background, attributes := s.parts()
+
+	if foreground == "" {
+		foreground = "-"
+	}
+
+	if attributes == "" {
+		attributes = "-"
+	}
+
+	return fmt.Sprintf("[%s:%s:%s]", foreground, background, attributes)
+}
+
+// With returns the style with attributes added to its own, e.g. "b" to make it bold.
+func (s Style) With(attributes string) Style {
+	foreground, background, own := s.parts()
+	if own == "-" {
+		own = ""
+	}
+
+	return Style(foreground + ":" + background + ":" + own + attributes)
+}
+
+// Color returns the foreground colour of the style.
+func (s Style) Color() tcell.Color {
+	foreground, _, _ := s.parts()
+	if foreground == "" || foreground == "-" {
+		return tcell.ColorDefault
+	}
+
+	return tcell.GetColor(foreground)
+}
+
+func (s Style) parts() (foreground, background, attributes string) {
+	parts := strings.SplitN(string(s), ":", 3)
+	parts = append(parts, "", "")
+
+	return parts[0], parts[1], parts[2]
+}
+
+func (s Style) validate() error {
+	foreground, background, attributes := s.parts()
+
+	for _, color := range []string{foreground, background} {
+		if color != "" && color != "-" && color != "default" && tcell.GetColor(color) == tcell.ColorDefault {
+			return fmt.Errorf("unknown colour %q in %q", color, s)
+		}
+	}
+
+	if strings.Trim(attributes, "lbidrus") != "" && attributes != "-" {
+		return fmt.Errorf("unknown attributes %q in %q, use any of l, b, i, d, r, u and s", attributes, s)
+	}
+
+	return nil
+}
@@ -1,13 +1,21 @@
 package ws
 
 import (
-	"fmt"
 	"github.com/gorilla/websocket"
+	"net/url"
 )
 
-func NewWebsocketClient(username string) (*websocket.Conn, error) {
-	socketUrl := fmt.Sprintf("ws://localhost:8080/chat?jwt=%s", username)
-	conn, _, err := websocket.DefaultDialer.Dial(socketUrl, nil)
+func NewWebsocketClient(socketUrl, jwt string) (*websocket.Conn, error) {
+	u, err := url.Parse(socketUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	query.Set("jwt", jwt)
+	u.RawQuery = query.Encode()
+
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -15,8 +23,8 @@ func NewWebsocketClient(username string) (*websocket.Conn, error) {
 	return conn, nil
 }
 
-func Ping() bool {
-	_, _, err := websocket.DefaultDialer.Dial("ws://localhost:8080/health", nil)
+func Ping(healthUrl string) bool {
+	_, _, err := websocket.DefaultDialer.Dial(healthUrl, nil)
 	if err != nil {
 		return false
 	}
@@ -0,0 +1,310 @@
+package ws
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// pongWait is how long the connection may stay silent before it's considered dead,
+	// pings are sent often enough for the server to answer well within it.
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	writeWait  = 10 * time.Second
+
+	minBackoff = 1 * time.Second
+	maxBackoff = 2 * time.Minute
+)
+
+var ErrNotConnected = errors.New("not connected")
+
+type State int
+
+const (
+	Connecting State = iota
+	Connected
+	Reconnecting
+	Closed
+)
+
+func (s State) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Reconnecting:
+		return "reconnecting"
+	}
+
+	return "closed"
+}
+
+// Event describes a change of the connection state. NextRetry is set while reconnecting and
+// Err holds the reason the last attempt or connection failed, if any.
+type Event struct {
+	State     State
+	Attempt   int
+	NextRetry time.Time
+	Err       error
+}
+
+// Manager keeps a websocket connection alive: it reconnects with exponential backoff and jitter,
+// and detects half-open connections with pings and read deadlines.
+type Manager struct {
+	socketUrl string
+	token     func() (string, error)
+	messages  chan []byte
+	done      chan struct{}
+
+	mu          sync.Mutex
+	conn        *websocket.Conn
+	event       Event
+	subscribers []chan Event
+
+	writeMu sync.Mutex
+}
+
+// NewManager creates a Manager for the websocket at socketUrl, token is called before every
+// connection attempt and must return a valid JWT.
+func NewManager(socketUrl string, token func() (string, error)) *Manager {
+	return &Manager{
+		socketUrl: socketUrl,
+		token:     token,
+		messages:  make(chan []byte, 64),
+		done:      make(chan struct{}),
+		event:     Event{State: Connecting},
+	}
+}
+
+// Messages returns the channel incoming messages are delivered on, it's closed once the Manager is closed.
+func (m *Manager) Messages() <-chan []byte {
+	return m.messages
+}
+
+// Subscribe returns a channel receiving every connection state change. Events are dropped for subscribers
+// that don't keep up, use State to get the current one.
+func (m *Manager) Subscribe() <-chan Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := make(chan Event, 16)
+	m.subscribers = append(m.subscribers, events)
+
+	return events
+}
+
+// State returns the latest connection state.
+func (m *Manager) State() Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.event
+}
+
+// IsConnected reports whether messages can currently be sent.
+func (m *Manager) IsConnected() bool {
+	return m.State().State == Connected
+}
+
+// Run connects and keeps reconnecting until Close is called.
+func (m *Manager) Run() {
+	defer close(m.messages)
+
+	attempt := 0
+
+	for {
+		m.publish(Event{State: Connecting, Attempt: attempt})
+
+		conn, err := m.dial()
+		if err == nil {
+			attempt = 0
+			m.publish(Event{State: Connected})
+
+			err = m.readMessages(conn)
+		}
+
+		if m.isClosed() {
+			return
+		}
+
+		delay := backoff(attempt)
+		attempt++
+
+		m.publish(Event{State: Reconnecting, Attempt: attempt, NextRetry: time.Now().Add(delay), Err: err})
+
+		select {
+		case <-time.After(delay):
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// WriteJSON sends v over the current connection.
+func (m *Manager) WriteJSON(v interface{}) error {
+	m.mu.Lock()
+	conn := m.conn
+	m.mu.Unlock()
+
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+
+	return conn.WriteJSON(v)
+}
+
+// Close disconnects and stops reconnecting.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.isClosedLocked() {
+		return
+	}
+
+	close(m.done)
+
+	if m.conn != nil {
+		m.conn.Close()
+	}
+
+	m.setEvent(Event{State: Closed})
+}
+
+func (m *Manager) dial() (*websocket.Conn, error) {
+	jwt, err := m.token()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := NewWebsocketClient(m.socketUrl, jwt)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.isClosedLocked() {
+		conn.Close()
+		return nil, errors.New("closed")
+	}
+
+	m.conn = conn
+
+	return conn, nil
+}
+
+// readMessages forwards messages from conn until it fails, pinging the server in the meantime.
+func (m *Manager) readMessages(conn *websocket.Conn) error {
+	stopPinging := make(chan struct{})
+	defer close(stopPinging)
+
+	go m.ping(conn, stopPinging)
+
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			m.mu.Lock()
+			m.conn = nil
+			m.mu.Unlock()
+
+			conn.Close()
+
+			return err
+		}
+
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		select {
+		case m.messages <- message:
+		case <-m.done:
+			return nil
+		}
+	}
+}
+
+func (m *Manager) ping(conn *websocket.Conn, stop chan struct{}) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				// the read deadline takes care of tearing the connection down
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (m *Manager) publish(event Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.isClosedLocked() {
+		return
+	}
+
+	m.setEvent(event)
+}
+
+func (m *Manager) setEvent(event Event) {
+	m.event = event
+
+	for _, subscriber := range m.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+func (m *Manager) isClosed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.isClosedLocked()
+}
+
+func (m *Manager) isClosedLocked() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff returns how long to wait before the given reconnection attempt: the delay doubles with
+// every attempt up to maxBackoff, and a random half of it is added as jitter so clients don't
+// reconnect in lockstep after a server restart.
+func backoff(attempt int) time.Duration {
+	delay := maxBackoff
+	if attempt < 16 {
+		delay = minBackoff << uint(attempt)
+	}
+
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}